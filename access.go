@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//access log line the gorouter writes for every request it routes to an app. the status code follows the quoted
+//request and response_time is in seconds
+var rtr_request = regexp.MustCompile(`\[RTR/\d+\].*"[A-Z]+ [^"]*" (\d{3}) .*response_time:([0-9.]+)`)
+
+//status codes and latencies of the requests an app served
+type AccessStats struct {
+	requests  int
+	statuses  map[string]int
+	latencies []time.Duration
+}
+
+func parseAccessLogs(lines []string) AccessStats {
+	stats := AccessStats{statuses: map[string]int{}, latencies: []time.Duration{}}
+	for _, val := range lines {
+		match := rtr_request.FindStringSubmatch(val)
+		if match == nil {
+			continue
+		}
+		seconds, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			continue
+		}
+		stats.requests++
+		stats.statuses[match[1][:1]+"xx"]++
+		stats.latencies = append(stats.latencies, time.Duration(seconds*float64(time.Second)))
+	}
+	sort.Slice(stats.latencies, func(i, j int) bool { return stats.latencies[i] < stats.latencies[j] })
+	return stats
+}
+
+//percentage of requests that failed with a 5xx
+func (s AccessStats) errorRate() float64 {
+	if s.requests == 0 {
+		return 0
+	}
+	return float64(s.statuses["5xx"]) * 100 / float64(s.requests)
+}
+
+//nearest rank percentile of the latencies
+func (s AccessStats) percentile(p float64) time.Duration {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(s.latencies)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return s.latencies[rank]
+}
+
+func (s AccessStats) String() string {
+	summary := fmt.Sprintf("%d requests,", s.requests)
+	for _, class := range []string{"2xx", "3xx", "4xx", "5xx"} {
+		summary += fmt.Sprintf(" %s %d", class, s.statuses[class])
+	}
+	return summary + fmt.Sprintf(" (%.2f%% 5xx), p50 %s p95 %s p99 %s", s.errorRate(), s.percentile(50), s.percentile(95), s.percentile(99))
+}
+
+//router access logs of the app since its production routes were shared with the new app
+func (c *SafeScaler) accessStats(cliConnection plugin.CliConnection, app *AppProp) (AccessStats, error) {
+	output, err := cliConnection.CliCommandWithoutTerminalOutput("logs", app.name, "--recent")
+	if err != nil {
+		return AccessStats{}, errors.New("ERROR. Could not get the recent logs of " + app.name + "\n")
+	}
+	return parseAccessLogs(filterLogs(output, c.mapped)), nil
+}
+
+//gate before the old app is unmapped. compares the 5xx rate and p99 latency the new app served on the production
+//routes with the old app's and hands the traffic back to the old app when the new app is worse by more than the
+//--error-margin or --latency-margin
+func (c *SafeScaler) compareAccessLogs(cliConnection plugin.CliConnection) error {
+	if c.error_margin < 0 && c.latency_margin < 0 {
+		return nil
+	}
+	blue, err := c.accessStats(cliConnection, c.blue)
+	if err != nil {
+		return err
+	}
+	green, err := c.accessStats(cliConnection, c.green)
+	if err != nil {
+		return err
+	}
+	fmt.Println(c.blue.name + ": " + blue.String())
+	fmt.Println(c.green.name + ": " + green.String())
+	if green.requests == 0 || blue.requests == 0 {
+		fmt.Println("WARNING. Not enough router logs to compare " + c.green.name + " with " + c.blue.name)
+		return nil
+	}
+	if c.error_margin >= 0 && green.errorRate()-blue.errorRate() > c.error_margin {
+		return c.abortTraffic(cliConnection, fmt.Errorf("ERROR. %s served %.2f%% 5xx against %.2f%% for %s, more than the error margin of %.2f%%\n", c.green.name, green.errorRate(), blue.errorRate(), c.blue.name, c.error_margin))
+	}
+	margin := time.Duration(c.latency_margin) * time.Millisecond
+	if c.latency_margin >= 0 && green.percentile(99)-blue.percentile(99) > margin {
+		return c.abortTraffic(cliConnection, fmt.Errorf("ERROR. p99 latency of %s is %s against %s for %s, more than the latency margin of %s\n", c.green.name, green.percentile(99), blue.percentile(99), c.blue.name, margin))
+	}
+	return nil
+}
+
+//hands the production routes back to the old app the way the canary that shared them would
+func (c *SafeScaler) abortTraffic(cliConnection plugin.CliConnection, cause error) error {
+	if len(c.weights) > 0 {
+		http_routes := []Route{}
+		for _, val := range c.blue_routes {
+			if val.port == 0 {
+				http_routes = append(http_routes, val)
+			}
+		}
+		blue_guid, err := c.appGuid(cliConnection, c.blue)
+		if err != nil {
+			return errors.New(cause.Error() + "ERROR. Could not find the guid of " + c.blue.name + "\n")
+		}
+		return c.abortWeights(cliConnection, http_routes, blue_guid, cause)
+	}
+	if c.canary_steps > 0 {
+		return c.abortCanary(cliConnection, cause)
+	}
+	return c.abort(cliConnection, cause.Error())
+}
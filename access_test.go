@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//gorouter access log lines as cf logs --recent prints them
+func rtrLine(stamp string, status string, response_time string) string {
+	return "   " + stamp + " [RTR/1] OUT shop.cfapps.io - [2026-10-19T12:00:05.123456789Z] \"GET /api/orders?page=2 HTTP/1.1\" " +
+		status + " 0 1532 \"-\" \"Mozilla/5.0 (X11; Linux x86_64)\" \"10.0.4.17:47782\" \"10.0.5.22:61012\" " +
+		"x_forwarded_for:\"203.0.113.9, 10.0.4.17\" x_forwarded_proto:\"https\" vcap_request_id:\"7b1c3e8a-2f4d-4e0c-9d1a-5f6b7c8d9e0f\" " +
+		"response_time:" + response_time + " gorouter_time:0.000213 app_id:\"green-guid\" app_index:\"0\" instance_id:\"a1b2c3d4\" " +
+		"x_cf_routererror:\"-\" x_b3_traceid:\"4bf92f3577b34da6\" x_b3_spanid:\"00f067aa0ba902b7\" x_b3_parentspanid:\"-\" b3:\"4bf92f3577b34da6-00f067aa0ba902b7\""
+}
+
+var _ = Describe("access logs", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		logs          map[string][]string
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.CliCommandReturns([]string{"OK"}, nil)
+		logs = map[string][]string{
+			"shop-v1": {
+				rtrLine("2026-10-19T11:59:00.00+0000", "500", "9.000000"),
+				rtrLine("2026-10-19T12:00:01.00+0000", "200", "0.010000"),
+				rtrLine("2026-10-19T12:00:02.00+0000", "200", "0.020000"),
+				rtrLine("2026-10-19T12:00:03.00+0000", "404", "0.005000"),
+				"   2026-10-19T12:00:03.00+0000 [APP/PROC/WEB/0] OUT GET /api/orders 200",
+				rtrLine("2026-10-19T12:00:04.00+0000", "200", "0.030000"),
+			},
+			"shop-v2": {
+				rtrLine("2026-10-19T12:00:01.00+0000", "200", "0.012000"),
+				rtrLine("2026-10-19T12:00:02.00+0000", "503", "0.002000"),
+				rtrLine("2026-10-19T12:00:03.00+0000", "200", "0.025000"),
+				rtrLine("2026-10-19T12:00:04.00+0000", "302", "0.040000"),
+			},
+		}
+		connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			if args[0] != "logs" {
+				return nil, errors.New("unexpected command")
+			}
+			return logs[args[1]], nil
+		}
+		prod := Route{host: "shop", domain: "cfapps.io"}
+		temp := Route{host: "temp-shop", domain: "cfapps.io"}
+		ExamplePlugin = &SafeScaler{
+			blue:           &AppProp{name: "shop-v1", routes: []Route{prod, temp}, alive: true},
+			green:          &AppProp{name: "shop-v2", routes: []Route{prod}, alive: true},
+			blue_routes:    []Route{prod},
+			temp_routes:    []Route{temp},
+			mapped:         time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+			error_margin:   -1,
+			latency_margin: -1,
+		}
+	})
+	Describe("parsing", func() {
+		It("should count statuses and latencies of the router lines only", func() {
+			stats := parseAccessLogs(filterLogs(logs["shop-v1"], ExamplePlugin.mapped))
+			Expect(stats.requests).To(Equal(4))
+			Expect(stats.statuses).To(Equal(map[string]int{"2xx": 3, "4xx": 1}))
+			Expect(stats.latencies).To(Equal([]time.Duration{5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond}))
+		})
+		It("should compute the 5xx rate and percentiles", func() {
+			stats := parseAccessLogs(logs["shop-v2"])
+			Expect(stats.errorRate()).To(Equal(25.0))
+			Expect(stats.percentile(50)).To(Equal(12 * time.Millisecond))
+			Expect(stats.percentile(99)).To(Equal(40 * time.Millisecond))
+			Expect(stats.String()).To(Equal("4 requests, 2xx 2 3xx 1 4xx 0 5xx 1 (25.00% 5xx), p50 12ms p95 40ms p99 40ms"))
+		})
+		It("should ignore lines that aren't router access logs", func() {
+			stats := parseAccessLogs([]string{
+				"   2026-10-19T12:00:03.00+0000 [APP/PROC/WEB/0] OUT GET /api/orders 500 response_time:1.0",
+				"Retrieving logs for app shop-v2 in org org / space sandbox as admin...",
+			})
+			Expect(stats.requests).To(Equal(0))
+			Expect(stats.percentile(99)).To(Equal(time.Duration(0)))
+		})
+	})
+	Describe("gate", func() {
+		It("should do nothing without margins", func() {
+			err := ExamplePlugin.compareAccessLogs(connection)
+			Expect(err).To(BeNil())
+			Expect(connection.CliCommandWithoutTerminalOutputCallCount()).To(Equal(0))
+		})
+		It("should pass when the new app is within the margins", func() {
+			ExamplePlugin.error_margin = 30
+			ExamplePlugin.latency_margin = 20
+			err := ExamplePlugin.compareAccessLogs(connection)
+			Expect(err).To(BeNil())
+			Expect(cliCommands(connection)).To(BeEmpty())
+		})
+		It("should hand the traffic back when the new app fails more requests", func() {
+			ExamplePlugin.error_margin = 5
+			err := ExamplePlugin.compareAccessLogs(connection)
+			Expect(err.Error()).To(Equal("ERROR. shop-v2 served 25.00% 5xx against 0.00% for shop-v1, more than the error margin of 5.00%\n" +
+				"ERROR. Deployment was aborted. Production routes are served by shop-v1\n"))
+			Expect(cliCommands(connection)).To(Equal([]string{
+				"unmap-route shop-v2 cfapps.io --hostname shop",
+				"unmap-route shop-v1 cfapps.io --hostname temp-shop",
+				"delete-route cfapps.io --hostname temp-shop -f",
+			}))
+		})
+		It("should hand the traffic back when the new app is slower", func() {
+			ExamplePlugin.latency_margin = 5
+			ExamplePlugin.canary_steps = 2
+			ExamplePlugin.blue.instances = 4
+			err := ExamplePlugin.compareAccessLogs(connection)
+			Expect(err.Error()).To(Equal("ERROR. p99 latency of shop-v2 is 40ms against 30ms for shop-v1, more than the latency margin of 5ms\n" +
+				"ERROR. Canary was rolled back. Production routes are served by shop-v1 only\n"))
+			Expect(cliCommands(connection)[0]).To(Equal("scale shop-v1 -i 4"))
+		})
+		It("should need a canary window to compare the apps in", func() {
+			for _, args := range [][]string{
+				{"--error-margin", "1"},
+				{"--latency-margin", "20", "--canary-steps", "2", "--canary-hold", "0"},
+			} {
+				err := ExamplePlugin.parseFlags(args)
+				Expect(err.Error()).To(Equal("ERROR. --error-margin and --latency-margin need a canary holding its stages for --canary-hold seconds to compare the apps in\n"))
+			}
+			Expect(ExamplePlugin.parseFlags([]string{"--error-margin", "1", "--weights", "10,50"})).To(BeNil())
+			Expect(ExamplePlugin.parseFlags([]string{"--latency-margin", "20", "--strategy", "canary"})).To(BeNil())
+		})
+		It("should not judge without traffic on both apps", func() {
+			ExamplePlugin.error_margin = 0
+			logs["shop-v2"] = []string{}
+			err := ExamplePlugin.compareAccessLogs(connection)
+			Expect(err).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//what secrets are replaced with in the output of the plugin
+const redacted = "[REDACTED]"
+
+//headers whose values are secret even when they are given on the command line
+var secret_headers = []string{"authorization", "cookie", "token", "key", "secret", "password"}
+
+//--header values, can be repeated
+type Headers []string
+
+func (h *Headers) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *Headers) Set(value string) error {
+	if i := strings.Index(value, ":"); i < 1 {
+		return errors.New("ERROR. " + value + " is not a header like X-Api-Key: env:API_KEY\n")
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+//values that are sent to the app endpoints but never printed
+type Secrets struct {
+	mutex  sync.Mutex
+	values []string
+}
+
+func (s *Secrets) add(value string) {
+	//too short to tell apart from ordinary output
+	if len(value) < 4 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, val := range s.values {
+		if val == value {
+			return
+		}
+	}
+	s.values = append(s.values, value)
+}
+
+func (s *Secrets) redact(text string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, val := range s.values {
+		text = strings.Replace(text, val, redacted, -1)
+	}
+	return text
+}
+
+//output of the plugin without the secrets of --header, --basic-auth, --bearer-token and --cf-token
+func (c *SafeScaler) redact(text string) string {
+	if c.secrets == nil {
+		return text
+	}
+	return c.secrets.redact(text)
+}
+
+//value of a flag that is read from an environment variable with env:NAME or from a file with file:path, and whether
+//it came from one of them
+func readSecret(value string) (string, bool, error) {
+	if strings.HasPrefix(value, "env:") {
+		name := strings.TrimPrefix(value, "env:")
+		secret, found := os.LookupEnv(name)
+		if !found {
+			return "", true, errors.New("environment variable " + name + " is not set")
+		}
+		return secret, true, nil
+	}
+	if strings.HasPrefix(value, "file:") {
+		content, err := ioutil.ReadFile(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return "", true, err
+		}
+		return strings.TrimSpace(string(content)), true, nil
+	}
+	return value, false, nil
+}
+
+//adds the --header, --basic-auth, --bearer-token and --cf-token credentials to every request of the client to the
+//app endpoints, so authenticated health and transaction endpoints can be used
+func (c *SafeScaler) authorize(cliConnection plugin.CliConnection, client *http.Client) error {
+	c.secrets = &Secrets{}
+	headers := http.Header{}
+	for _, val := range c.headers {
+		i := strings.Index(val, ":")
+		name := strings.TrimSpace(val[:i])
+		value, from_source, err := readSecret(strings.TrimSpace(val[i+1:]))
+		if err != nil {
+			return errors.New("ERROR. Could not read the value of the " + name + " header. " + err.Error() + "\n")
+		}
+		if from_source || secretHeader(name) {
+			c.secrets.add(value)
+		}
+		headers.Add(name, value)
+	}
+	if c.basic_auth != "" {
+		credentials, _, err := readSecret(c.basic_auth)
+		if err != nil {
+			return errors.New("ERROR. Could not read the basic auth credentials. " + err.Error() + "\n")
+		}
+		i := strings.Index(credentials, ":")
+		if i < 1 {
+			return errors.New("ERROR. The basic auth credentials need to be user:password\n")
+		}
+		encoded := base64.StdEncoding.EncodeToString([]byte(credentials))
+		c.secrets.add(credentials[i+1:])
+		c.secrets.add(encoded)
+		headers.Set("Authorization", "Basic "+encoded)
+	}
+	if c.bearer_token != "" {
+		token, _, err := readSecret(c.bearer_token)
+		if err != nil {
+			return errors.New("ERROR. Could not read the bearer token. " + err.Error() + "\n")
+		}
+		c.secrets.add(token)
+		headers.Set("Authorization", "Bearer "+token)
+	}
+	if c.cf_token {
+		//asked for once, the probes and the warm-up send requests from goroutines that must not use the plugin rpc
+		token, err := cliConnection.AccessToken()
+		if err != nil {
+			return errors.New("ERROR. Could not get the access token of the cf cli. " + err.Error() + "\n")
+		}
+		c.secrets.add(strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(token, "bearer "), "Bearer ")))
+		headers.Set("Authorization", token)
+	}
+	transport := &authTransport{next: client.Transport, headers: headers}
+	if transport.next == nil {
+		transport.next = http.DefaultTransport
+	}
+	client.Transport = transport
+	client.CheckRedirect = sameHost
+	return nil
+}
+
+//follows redirects on the host the request was sent to. a redirect to another host is returned as the response
+//rather than sending the credentials there
+func sameHost(request *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if request.URL.Host != via[0].URL.Host {
+		return http.ErrUseLastResponse
+	}
+	return nil
+}
+
+func secretHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, val := range secret_headers {
+		if strings.Contains(name, val) {
+			return true
+		}
+	}
+	return false
+}
+
+//sets the credentials on the requests it sends
+type authTransport struct {
+	next    http.RoundTripper
+	headers http.Header
+}
+
+func (t *authTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	//a round tripper must not change the request it was given
+	outgoing := request.Clone(request.Context())
+	for name, values := range t.headers {
+		outgoing.Header[name] = values
+	}
+	return t.next.RoundTrip(outgoing)
+}
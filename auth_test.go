@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("auth", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		server        *httptest.Server
+		client        *http.Client
+		dir           string
+		received      []http.Header
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.AccessTokenReturns("bearer cf-oauth-token", nil)
+		dir, _ = ioutil.TempDir("", "auth")
+		received = []http.Header{}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = append(received, r.Header)
+			if r.Header.Get("Authorization") == "" {
+				w.WriteHeader(401)
+			}
+		}))
+		client = &http.Client{}
+		ExamplePlugin = &SafeScaler{
+			green:  &AppProp{name: "shop-v2", routes: []Route{{host: "shop-v2", domain: "cfapps.io"}}, alive: true},
+			scheme: "http",
+			test:   "/health/deep",
+		}
+	})
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+	It("should send static headers and read secret ones from the environment", func() {
+		os.Setenv("SAFE_SCALE_TEST_KEY", "k3y-from-env")
+		defer os.Unsetenv("SAFE_SCALE_TEST_KEY")
+		ExamplePlugin.headers = Headers{"Accept: application/json", "X-Api-Key: env:SAFE_SCALE_TEST_KEY"}
+		Expect(ExamplePlugin.authorize(connection, client)).To(BeNil())
+		client.Get(server.URL + "/health/deep")
+		Expect(received[0].Get("Accept")).To(Equal("application/json"))
+		Expect(received[0].Get("X-Api-Key")).To(Equal("k3y-from-env"))
+		Expect(ExamplePlugin.redact("Accept application/json with k3y-from-env")).To(Equal("Accept application/json with [REDACTED]"))
+	})
+	It("should authenticate health tests with basic auth", func() {
+		ExamplePlugin.basic_auth = "deployer:s3cret-pass"
+		Expect(ExamplePlugin.authorize(connection, client)).To(BeNil())
+		ExamplePlugin.green.routes = []Route{{domain: strings.TrimPrefix(server.URL, "http://")}}
+		Expect(ExamplePlugin.healthTest(client)).To(BeTrue())
+		user, password, ok := (&http.Request{Header: received[0]}).BasicAuth()
+		Expect(ok).To(BeTrue())
+		Expect(user + ":" + password).To(Equal("deployer:s3cret-pass"))
+		Expect(ExamplePlugin.redact("login s3cret-pass " + received[0].Get("Authorization"))).To(Equal("login [REDACTED] Basic [REDACTED]"))
+	})
+	It("should read bearer tokens from files", func() {
+		path := filepath.Join(dir, "token")
+		ioutil.WriteFile(path, []byte("eyJhbGciOi.token\n"), 0600)
+		ExamplePlugin.bearer_token = "file:" + path
+		Expect(ExamplePlugin.authorize(connection, client)).To(BeNil())
+		client.Get(server.URL + "/transactions")
+		Expect(received[0].Get("Authorization")).To(Equal("Bearer eyJhbGciOi.token"))
+		ExamplePlugin.bearer_token = "file:" + filepath.Join(dir, "missing")
+		Expect(ExamplePlugin.authorize(connection, &http.Client{})).NotTo(BeNil())
+	})
+	It("should forward the token of the cf cli", func() {
+		calls := 0
+		connection.AccessTokenStub = func() (string, error) {
+			calls++
+			return "bearer cf-oauth-token", nil
+		}
+		ExamplePlugin.cf_token = true
+		Expect(ExamplePlugin.authorize(connection, client)).To(BeNil())
+		client.Get(server.URL + "/transactions")
+		client.Get(server.URL + "/transactions")
+		Expect(calls).To(Equal(1))
+		Expect(received[1].Get("Authorization")).To(Equal("bearer cf-oauth-token"))
+		Expect(ExamplePlugin.redact("sent bearer cf-oauth-token")).To(Equal("sent bearer [REDACTED]"))
+	})
+	It("should not send the credentials to other hosts", func() {
+		elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = append(received, r.Header)
+		}))
+		defer elsewhere.Close()
+		redirect := httptest.NewServer(http.RedirectHandler(elsewhere.URL+"/login", 302))
+		defer redirect.Close()
+		ExamplePlugin.cf_token = true
+		Expect(ExamplePlugin.authorize(connection, client)).To(BeNil())
+		result, err := client.Get(redirect.URL + "/health/deep")
+		Expect(err).To(BeNil())
+		Expect(result.StatusCode).To(Equal(302))
+		Expect(received).To(BeEmpty())
+	})
+	It("should fail on credentials it can't read", func() {
+		ExamplePlugin.headers = Headers{"X-Api-Key: env:SAFE_SCALE_TEST_MISSING"}
+		err := ExamplePlugin.authorize(connection, client)
+		Expect(err.Error()).To(Equal("ERROR. Could not read the value of the X-Api-Key header. environment variable SAFE_SCALE_TEST_MISSING is not set\n"))
+		ExamplePlugin.headers = nil
+		ExamplePlugin.basic_auth = "deployer"
+		err = ExamplePlugin.authorize(connection, client)
+		Expect(err.Error()).To(Equal("ERROR. The basic auth credentials need to be user:password\n"))
+	})
+	It("should redact the logs it prints", func() {
+		ExamplePlugin.bearer_token = "t0ken-in-logs"
+		Expect(ExamplePlugin.authorize(connection, client)).To(BeNil())
+		connection.CliCommandWithoutTerminalOutputReturns([]string{"2026-10-19T10:00:00.00+0000 [APP/PROC/WEB/0] OUT Authorization: Bearer t0ken-in-logs"}, nil)
+		Expect(ExamplePlugin.recentLogs(connection, ExamplePlugin.green)).To(ContainSubstring("Authorization: Bearer [REDACTED]"))
+	})
+	It("should only take one kind of authentication", func() {
+		err := ExamplePlugin.parseFlags([]string{"--bearer-token", "env:TOKEN", "--cf-token"})
+		Expect(err.Error()).To(Equal("ERROR. Only one of --basic-auth, --bearer-token and --cf-token can be given\n"))
+		err = ExamplePlugin.parseFlags([]string{"--header", "X-Api-Key"})
+		Expect(err.Error()).To(ContainSubstring("X-Api-Key is not a header like X-Api-Key: env:API_KEY"))
+	})
+})
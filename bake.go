@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//watches the health of the new app through the production routes while the old app still runs on its temp routes.
+//the routes go back to the old app as soon as the new app turns unhealthy, or at the end when its --metric queries
+//came out worse than the old app's
+func (c *SafeScaler) bakeNewApp(cliConnection plugin.CliConnection, client *http.Client) error {
+	if c.bake <= 0 {
+		return nil
+	}
+	baseline := Baseline{}
+	if len(c.metrics) > 0 {
+		var err error
+		if baseline, err = c.scrapeApps(cliConnection, client); err != nil {
+			return c.abort(cliConnection, err.Error())
+		}
+	}
+	if c.test == "" {
+		fmt.Println("Keeping " + c.blue.name + " around for " + fmt.Sprint(c.bake) + " seconds")
+		time.Sleep(time.Duration(c.bake) * time.Second)
+		return c.compareMetrics(cliConnection, client, baseline)
+	}
+	fmt.Println("Baking " + c.green.name + " for " + fmt.Sprint(c.bake) + " seconds")
+	base := time.Now()
+	for time.Since(base) < time.Duration(c.bake)*time.Second {
+		if err := c.checkCrashes(cliConnection); err != nil {
+			return err
+		}
+		for _, val := range c.blue_routes {
+			if val.port != 0 {
+				continue
+			}
+			if endpoint := c.url(val, c.test); !c.healthy(client, endpoint) {
+				if err := c.restoreRoutes(cliConnection); err != nil {
+					return err
+				}
+				return errors.New("ERROR. " + endpoint + " became unhealthy while baking " + c.green.name + ". Routes were moved back to " + c.blue.name + "\n")
+			}
+		}
+		time.Sleep(poll_interval)
+	}
+	fmt.Println(c.green.name + " stayed healthy")
+	return c.compareMetrics(cliConnection, client, baseline)
+}
+
+//undoes the deployment as far as it got. the old app is started again if it was powered down, scaled back up after
+//a canary, gets its production routes back and loses its temp routes. the new app is left running without production routes
+func (c *SafeScaler) restoreRoutes(cliConnection plugin.CliConnection) error {
+	if c.replaced {
+		return c.keepStandby(cliConnection)
+	}
+	fmt.Println("Moving routes back to " + c.blue.name)
+	if !c.blue.alive {
+		if _, err := cliConnection.CliCommand("start", c.blue.name); err != nil {
+			return errors.New("ERROR. Unable to start " + c.blue.name + "\n")
+		}
+		c.blue.alive = true
+	}
+	//a canary leaves the old app with as little as one instance
+	if c.blue.scaled > 0 && c.blue.scaled < c.blue.instances {
+		if err := c.scaleApp(cliConnection, c.blue, c.blue.instances); err != nil {
+			return err
+		}
+	}
+	for _, val := range c.blue_routes {
+		if c.blue.hasRoute(val) {
+			continue
+		}
+		if err := c.addMap(cliConnection, c.blue, val); err != nil {
+			return err
+		}
+	}
+	//the maintenance app of the recreate strategy also gives the routes up
+	for _, app := range []*AppProp{c.green, c.standby} {
+		if app == nil || app == c.blue {
+			continue
+		}
+		for _, val := range c.blue_routes {
+			if !app.hasRoute(val) {
+				continue
+			}
+			if err := c.removeMap(cliConnection, app, val, false); err != nil {
+				return err
+			}
+		}
+	}
+	for _, val := range c.temp_routes {
+		if !c.blue.hasRoute(val) {
+			continue
+		}
+		if err := c.removeMap(cliConnection, c.blue, val, true); err != nil {
+			return err
+		}
+	}
+	c.labelApp(cliConnection, c.blue, role_live)
+	if c.green != c.blue {
+		c.labelApp(cliConnection, c.green, role_green)
+	}
+	return nil
+}
+
+//the old code is gone once an in-place strategy pushed over it. the production routes stay where they are, with the
+//maintenance app if there is one, rather than going to new code that wasn't verified. only the temp routes go
+func (c *SafeScaler) keepStandby(cliConnection plugin.CliConnection) error {
+	for _, val := range c.temp_routes {
+		if !c.blue.hasRoute(val) {
+			continue
+		}
+		if err := c.removeMap(cliConnection, c.blue, val, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	"github.com/nicholasf/fakepoint"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("bake", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		maker         *fakepoint.FakepointMaker
+		interval      time.Duration
+	)
+	BeforeEach(func() {
+		interval = poll_interval
+		poll_interval = 10 * time.Millisecond
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.CliCommandReturns([]string{"OK"}, nil)
+		maker = fakepoint.NewFakepointMaker()
+		prod := []Route{{host: "shop", domain: "cfapps.io"}, {host: "shop", domain: "apps.internal"}, {domain: "tcp.cfapps.io", port: 1024}}
+		temp := []Route{{host: "temp-shop", domain: "cfapps.io"}, {host: "temp-shop", domain: "apps.internal"}}
+		ExamplePlugin = &SafeScaler{
+			blue:        &AppProp{name: "shop-v1", routes: append([]Route{}, temp...), alive: true},
+			green:       &AppProp{name: "shop-v2", routes: append([]Route{}, prod...), alive: true},
+			blue_routes: prod,
+			temp_routes: temp,
+			test:        "/health",
+			bake:        1,
+		}
+	})
+	AfterEach(func() {
+		poll_interval = interval
+	})
+	It("should do nothing without a bake period", func() {
+		ExamplePlugin.bake = 0
+		err := ExamplePlugin.bakeNewApp(connection, maker.Client())
+		Expect(err).To(BeNil())
+	})
+	It("should pass when the new app stays healthy on every production route", func() {
+		maker.NewGet("https://shop.cfapps.io/health", 200).Duplicate(200)
+		maker.NewGet("https://shop.apps.internal/health", 200).Duplicate(200)
+		err := ExamplePlugin.bakeNewApp(connection, maker.Client())
+		Expect(err).To(BeNil())
+		Expect(connection.CliCommandCallCount()).To(Equal(0))
+	})
+	It("should move the routes back to the old app when the new app turns unhealthy", func() {
+		maker.NewGet("https://shop.cfapps.io/health", 200).Duplicate(200)
+		maker.NewGet("https://shop.apps.internal/health", 200).Duplicate(2)
+		maker.NewGet("https://shop.apps.internal/health", 503)
+		err := ExamplePlugin.bakeNewApp(connection, maker.Client())
+		Expect(err.Error()).To(Equal("ERROR. https://shop.apps.internal/health became unhealthy while baking shop-v2. Routes were moved back to shop-v1\n"))
+		commands := cliCommands(connection)
+		Expect(commands).To(Equal([]string{
+			"map-route shop-v1 cfapps.io --hostname shop",
+			"map-route shop-v1 apps.internal --hostname shop",
+			"map-route shop-v1 tcp.cfapps.io --port 1024",
+			"unmap-route shop-v2 cfapps.io --hostname shop",
+			"unmap-route shop-v2 apps.internal --hostname shop",
+			"unmap-route shop-v2 tcp.cfapps.io --port 1024",
+			"unmap-route shop-v1 cfapps.io --hostname temp-shop",
+			"delete-route cfapps.io --hostname temp-shop -f",
+			"unmap-route shop-v1 apps.internal --hostname temp-shop",
+			"delete-route apps.internal --hostname temp-shop -f",
+		}))
+		Expect(ExamplePlugin.blue.routes).To(Equal(ExamplePlugin.blue_routes))
+		Expect(ExamplePlugin.green.routes).To(Equal([]Route{}))
+	})
+	It("should fail if it can't move the routes back", func() {
+		maker.NewGet("https://shop.cfapps.io/health", 500)
+		connection.CliCommandReturns(nil, errors.New("could not map"))
+		err := ExamplePlugin.bakeNewApp(connection, maker.Client())
+		Expect(err.Error()).To(Equal("ERROR. Could not map cfapps.io.shop route to shop-v1\n"))
+	})
+})
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//shifts traffic on the production routes, which both apps are mapped to, by scaling the new app up and the old app
+//down in --canary-steps stages. every stage is held while the checks run and a failed check hands all traffic back
+//to the old app
+func (c *SafeScaler) canary(cliConnection plugin.CliConnection, client *http.Client) error {
+	if len(c.weights) > 0 {
+		return c.weightedCanary(cliConnection, client)
+	}
+	if c.canary_steps <= 0 {
+		return nil
+	}
+	target, err := strconv.Atoi(c.inst)
+	if err != nil || target < 1 {
+		return errors.New("ERROR. " + c.inst + " is not a valid number of instances for a canary\n")
+	}
+	if c.blue.instances < 1 {
+		c.blue.instances = 1
+	}
+	if err = c.holdCanary(client); err != nil {
+		return c.abortCanary(cliConnection, err)
+	}
+	for step := 1; step <= c.canary_steps; step++ {
+		green_inst, blue_inst := canaryInstances(target, c.blue.instances, step, c.canary_steps)
+		fmt.Printf("Canary stage %d of %d: %s at %d instances, %s at %d instances\n", step, c.canary_steps, c.green.name, green_inst, c.blue.name, blue_inst)
+		if err = c.scaleApp(cliConnection, c.green, green_inst); err != nil {
+			return c.abortCanary(cliConnection, err)
+		}
+		if err = c.scaleApp(cliConnection, c.blue, blue_inst); err != nil {
+			return c.abortCanary(cliConnection, err)
+		}
+		if err = c.holdCanary(client); err != nil {
+			return c.abortCanary(cliConnection, err)
+		}
+	}
+	return nil
+}
+
+//instance counts of the new and old app at a stage. the old app keeps one instance until it is unmapped
+func canaryInstances(target int, original int, step int, steps int) (int, int) {
+	green_inst := (target*step + steps - 1) / steps
+	if green_inst < 1 {
+		green_inst = 1
+	}
+	blue_inst := original - original*step/steps
+	if blue_inst < 1 {
+		blue_inst = 1
+	}
+	return green_inst, blue_inst
+}
+
+//runs the checks on the new app for --canary-hold seconds
+func (c *SafeScaler) holdCanary(client *http.Client) error {
+	base := time.Now()
+	for {
+		if crash := c.crashed(); crash != "" {
+			return crashError(c.green.name, crash)
+		}
+		if !c.healthTest(client) {
+			return errors.New("ERROR. " + c.green.name + " is not healthy\n")
+		}
+		if time.Since(base) >= time.Duration(c.canary_hold)*time.Second {
+			return nil
+		}
+		time.Sleep(poll_interval)
+	}
+}
+
+//hands all traffic back to the old app. the new app is unmapped from the production routes and left running
+func (c *SafeScaler) abortCanary(cliConnection plugin.CliConnection, cause error) error {
+	fmt.Println("Rolling back the canary")
+	if err := c.scaleApp(cliConnection, c.blue, c.blue.instances); err != nil {
+		return err
+	}
+	for _, val := range c.blue_routes {
+		if err := c.removeMap(cliConnection, c.green, val, false); err != nil {
+			return err
+		}
+	}
+	for _, val := range c.temp_routes {
+		if err := c.removeMap(cliConnection, c.blue, val, true); err != nil {
+			return err
+		}
+	}
+	c.labelApp(cliConnection, c.blue, role_live)
+	return errors.New(cause.Error() + "ERROR. Canary was rolled back. Production routes are served by " + c.blue.name + " only\n")
+}
+
+func (c *SafeScaler) scaleApp(cliConnection plugin.CliConnection, app *AppProp, instances int) error {
+	if _, err := cliConnection.CliCommand("scale", app.name, "-i", strconv.Itoa(instances)); err != nil {
+		return errors.New("ERROR. Could not scale " + app.name + " to " + strconv.Itoa(instances) + " instances\n")
+	}
+	app.scaled = instances
+	return nil
+}
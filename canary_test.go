@@ -0,0 +1,100 @@
+package main
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	"github.com/nicholasf/fakepoint"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("canary", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		maker         *fakepoint.FakepointMaker
+		interval      time.Duration
+	)
+	BeforeEach(func() {
+		interval = poll_interval
+		poll_interval = 10 * time.Millisecond
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.CliCommandReturns([]string{"OK"}, nil)
+		maker = fakepoint.NewFakepointMaker()
+		prod := []Route{{host: "shop", domain: "cfapps.io"}}
+		temp := []Route{{host: "temp-shop", domain: "cfapps.io"}}
+		ExamplePlugin = &SafeScaler{
+			blue:         &AppProp{name: "shop-v1", routes: append(append([]Route{}, prod...), temp...), instances: 10},
+			green:        &AppProp{name: "shop-v2", routes: append([]Route{{host: "shop-v2", domain: "cfapps.io"}}, prod...)},
+			blue_routes:  prod,
+			temp_routes:  temp,
+			test:         "/health",
+			inst:         "4",
+			canary_steps: 2,
+		}
+	})
+	AfterEach(func() {
+		poll_interval = interval
+	})
+	It("should do nothing without canary stages", func() {
+		ExamplePlugin.canary_steps = 0
+		err := ExamplePlugin.canary(connection, maker.Client())
+		Expect(err).To(BeNil())
+		Expect(connection.CliCommandCallCount()).To(Equal(0))
+	})
+	It("should push a single instance of the canary", func() {
+		ExamplePlugin.green.routes = []Route{}
+		err := ExamplePlugin.pushApp(connection)
+		Expect(err).To(BeNil())
+		Expect(connection.CliCommandArgsForCall(0)[3]).To(Equal("1"))
+	})
+	It("should shift the instances over in stages", func() {
+		maker.NewGet("https://shop-v2.cfapps.io/health", 200).Duplicate(10)
+		err := ExamplePlugin.canary(connection, maker.Client())
+		Expect(err).To(BeNil())
+		Expect(cliCommands(connection)).To(Equal([]string{
+			"scale shop-v2 -i 2",
+			"scale shop-v1 -i 5",
+			"scale shop-v2 -i 4",
+			"scale shop-v1 -i 1",
+		}))
+	})
+	It("should hand the traffic back to the old app when a stage fails", func() {
+		maker.NewGet("https://shop-v2.cfapps.io/health", 200)
+		maker.NewGet("https://shop-v2.cfapps.io/health", 500)
+		err := ExamplePlugin.canary(connection, maker.Client())
+		Expect(err.Error()).To(Equal("ERROR. shop-v2 is not healthy\nERROR. Canary was rolled back. Production routes are served by shop-v1 only\n"))
+		Expect(cliCommands(connection)).To(Equal([]string{
+			"scale shop-v2 -i 2",
+			"scale shop-v1 -i 5",
+			"scale shop-v1 -i 10",
+			"unmap-route shop-v2 cfapps.io --hostname shop",
+			"unmap-route shop-v1 cfapps.io --hostname temp-shop",
+			"delete-route cfapps.io --hostname temp-shop -f",
+		}))
+		Expect(ExamplePlugin.blue.routes).To(Equal([]Route{{host: "shop", domain: "cfapps.io"}}))
+	})
+	It("should scale the old app back up when a later step moves the routes back", func() {
+		maker.NewGet("https://shop-v2.cfapps.io/health", 200).Duplicate(10)
+		Expect(ExamplePlugin.canary(connection, maker.Client())).To(BeNil())
+		ExamplePlugin.blue.alive = true
+		err := ExamplePlugin.restoreRoutes(connection)
+		Expect(err).To(BeNil())
+		Expect(cliCommands(connection)[4]).To(Equal("scale shop-v1 -i 10"))
+		Expect(cliCommands(connection)).To(ContainElement("unmap-route shop-v2 cfapps.io --hostname shop"))
+	})
+	It("should fail with an invalid number of instances", func() {
+		ExamplePlugin.inst = "many"
+		err := ExamplePlugin.canary(connection, maker.Client())
+		Expect(err.Error()).To(Equal("ERROR. many is not a valid number of instances for a canary\n"))
+	})
+	It("should keep one instance of the old app until it is unmapped", func() {
+		green_inst, blue_inst := canaryInstances(3, 2, 3, 3)
+		Expect(green_inst).To(Equal(3))
+		Expect(blue_inst).To(Equal(1))
+		green_inst, blue_inst = canaryInstances(10, 10, 1, 4)
+		Expect(green_inst).To(Equal(3))
+		Expect(blue_inst).To(Equal(8))
+	})
+})
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+//builds the client the endpoints of the apps are requested with from the --connect-timeout, --read-timeout,
+//--skip-ssl-validation, --ca-cert, --client-cert, --client-key, --proxy and --probe-app flags
+func (c *SafeScaler) newClient() (*http.Client, error) {
+	config := &tls.Config{InsecureSkipVerify: c.skip_ssl_validation}
+	if c.ca_cert != "" {
+		bundle, err := ioutil.ReadFile(c.ca_cert)
+		if err != nil {
+			return nil, errors.New("ERROR. Could not read the CA bundle " + c.ca_cert + ". " + err.Error() + "\n")
+		}
+		//the bundle is trusted on top of the system roots, internal domains often share a router with public ones
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, errors.New("ERROR. There are no certificates in the CA bundle " + c.ca_cert + "\n")
+		}
+		config.RootCAs = pool
+	}
+	if c.client_cert != "" {
+		certificate, err := tls.LoadX509KeyPair(c.client_cert, c.client_key)
+		if err != nil {
+			return nil, errors.New("ERROR. Could not load the client certificate " + c.client_cert + ". " + err.Error() + "\n")
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	proxy := http.ProxyFromEnvironment
+	if c.proxy != "" {
+		address, err := url.Parse(c.proxy)
+		if err != nil || address.Host == "" {
+			return nil, errors.New("ERROR. " + c.proxy + " is not a proxy url like http://proxy.internal:8080\n")
+		}
+		proxy = http.ProxyURL(address)
+	}
+	connect := time.Duration(c.connect_timeout) * time.Second
+	read := time.Duration(c.read_timeout) * time.Second
+	dialer := &net.Dialer{Timeout: connect, KeepAlive: 30 * time.Second}
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       config,
+		TLSHandshakeTimeout:   connect,
+		ResponseHeaderTimeout: read,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	//ca bundles, client certificates and proxies are local files and settings the instance doesn't have
+	if c.probe_app != "" {
+		transport = &sshTransport{app: c.probe_app, instance: c.probe_instance, insecure: c.skip_ssl_validation, connect_timeout: c.connect_timeout, read_timeout: c.read_timeout}
+	}
+	client := &http.Client{Transport: transport}
+	if c.connect_timeout > 0 && c.read_timeout > 0 {
+		client.Timeout = connect + read
+	}
+	return client, nil
+}
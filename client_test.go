@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("client", func() {
+	var (
+		ExamplePlugin *SafeScaler
+		server        *httptest.Server
+		dir           string
+		requested     []string
+	)
+	BeforeEach(func() {
+		dir, _ = ioutil.TempDir("", "client")
+		requested = []string{}
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested = append(requested, r.URL.Path)
+			if r.URL.Path == "/slow" {
+				time.Sleep(1500 * time.Millisecond)
+			}
+		}))
+		ExamplePlugin = &SafeScaler{connect_timeout: 10, read_timeout: 30, scheme: "https"}
+	})
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+	It("should verify the certificates of the endpoints", func() {
+		client, err := ExamplePlugin.newClient()
+		Expect(err).To(BeNil())
+		_, err = client.Get(server.URL + "/health")
+		Expect(err).NotTo(BeNil())
+		Expect(requested).To(BeEmpty())
+	})
+	It("should skip ssl validation when asked to", func() {
+		ExamplePlugin.skip_ssl_validation = true
+		client, err := ExamplePlugin.newClient()
+		Expect(err).To(BeNil())
+		result, err := client.Get(server.URL + "/health")
+		Expect(err).To(BeNil())
+		Expect(result.StatusCode).To(Equal(200))
+	})
+	It("should trust a CA bundle", func() {
+		ExamplePlugin.ca_cert = filepath.Join(dir, "ca.pem")
+		ioutil.WriteFile(ExamplePlugin.ca_cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+		client, err := ExamplePlugin.newClient()
+		Expect(err).To(BeNil())
+		result, err := client.Get(server.URL + "/health")
+		Expect(err).To(BeNil())
+		Expect(result.StatusCode).To(Equal(200))
+	})
+	It("should fail on bundles and certificates it can't load", func() {
+		ExamplePlugin.ca_cert = filepath.Join(dir, "ca.pem")
+		ioutil.WriteFile(ExamplePlugin.ca_cert, []byte("not a certificate"), 0644)
+		_, err := ExamplePlugin.newClient()
+		Expect(err.Error()).To(Equal("ERROR. There are no certificates in the CA bundle " + ExamplePlugin.ca_cert + "\n"))
+		ExamplePlugin.ca_cert = ""
+		ExamplePlugin.client_cert = filepath.Join(dir, "client.pem")
+		ExamplePlugin.client_key = filepath.Join(dir, "client.key")
+		_, err = ExamplePlugin.newClient()
+		Expect(err.Error()).To(HavePrefix("ERROR. Could not load the client certificate " + ExamplePlugin.client_cert + "."))
+	})
+	It("should give up on endpoints that don't answer in the read timeout", func() {
+		ExamplePlugin.skip_ssl_validation = true
+		ExamplePlugin.read_timeout = 1
+		client, err := ExamplePlugin.newClient()
+		Expect(err).To(BeNil())
+		_, err = client.Get(server.URL + "/slow")
+		Expect(err).NotTo(BeNil())
+	})
+	It("should build the urls of routes with the scheme", func() {
+		route := Route{host: "shop-v2", domain: "apps.internal", path: "/api"}
+		Expect(ExamplePlugin.url(route, "/health")).To(Equal("https://shop-v2.apps.internal/api/health"))
+		ExamplePlugin.scheme = "http"
+		Expect(ExamplePlugin.url(route, "/health")).To(Equal("http://shop-v2.apps.internal/api/health"))
+	})
+	It("should request routes over http with the http scheme", func() {
+		plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested = append(requested, r.URL.Path)
+		}))
+		defer plain.Close()
+		ExamplePlugin.scheme = "http"
+		client, err := ExamplePlugin.newClient()
+		Expect(err).To(BeNil())
+		route := Route{domain: strings.TrimPrefix(plain.URL, "http://")}
+		result, err := client.Get(ExamplePlugin.url(route, "/health"))
+		Expect(err).To(BeNil())
+		Expect(result.StatusCode).To(Equal(200))
+		Expect(requested).To(Equal([]string{"/health"}))
+	})
+	It("should send the requests through the proxy", func() {
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested = append(requested, "proxied "+r.URL.String())
+		}))
+		defer proxy.Close()
+		ExamplePlugin.scheme = "http"
+		ExamplePlugin.proxy = proxy.URL
+		client, err := ExamplePlugin.newClient()
+		Expect(err).To(BeNil())
+		_, err = client.Get(ExamplePlugin.url(Route{host: "shop-v2", domain: "apps.internal"}, "/health"))
+		Expect(err).To(BeNil())
+		Expect(requested).To(Equal([]string{"proxied http://shop-v2.apps.internal/health"}))
+		ExamplePlugin.proxy = "proxy.internal"
+		_, err = ExamplePlugin.newClient()
+		Expect(err.Error()).To(Equal("ERROR. proxy.internal is not a proxy url like http://proxy.internal:8080\n"))
+	})
+	It("should check the scheme and the client certificate flags", func() {
+		err := ExamplePlugin.parseFlags([]string{"--scheme", "ftp"})
+		Expect(err.Error()).To(Equal("ERROR. --scheme needs to be https or http\n"))
+		err = ExamplePlugin.parseFlags([]string{"--client-cert", "client.pem"})
+		Expect(err.Error()).To(Equal("ERROR. --client-cert and --client-key need to be given together\n"))
+	})
+})
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry/cli/plugin"
+	"github.com/cloudfoundry/cli/plugin/models"
+)
+
+//hands the cli connection to one caller at a time. the plugin rpc isn't safe to use from several goroutines, and the
+//crash watcher polls it while the deployment runs its commands. a long command like cf push makes the watcher wait
+type lockedConnection struct {
+	plugin.CliConnection
+	mutex sync.Mutex
+}
+
+func (l *lockedConnection) CliCommandWithoutTerminalOutput(args ...string) ([]string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.CliCommandWithoutTerminalOutput(args...)
+}
+
+func (l *lockedConnection) CliCommand(args ...string) ([]string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.CliCommand(args...)
+}
+
+func (l *lockedConnection) GetCurrentOrg() (plugin_models.Organization, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.GetCurrentOrg()
+}
+
+func (l *lockedConnection) GetCurrentSpace() (plugin_models.Space, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.GetCurrentSpace()
+}
+
+func (l *lockedConnection) Username() (string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.Username()
+}
+
+func (l *lockedConnection) UserGuid() (string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.UserGuid()
+}
+
+func (l *lockedConnection) UserEmail() (string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.UserEmail()
+}
+
+func (l *lockedConnection) IsLoggedIn() (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.IsLoggedIn()
+}
+
+func (l *lockedConnection) IsSSLDisabled() (bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.IsSSLDisabled()
+}
+
+func (l *lockedConnection) ApiEndpoint() (string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.ApiEndpoint()
+}
+
+func (l *lockedConnection) ApiVersion() (string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.ApiVersion()
+}
+
+func (l *lockedConnection) AccessToken() (string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.AccessToken()
+}
+
+func (l *lockedConnection) GetApp(name string) (plugin_models.GetAppModel, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.GetApp(name)
+}
+
+func (l *lockedConnection) GetApps() ([]plugin_models.GetAppsModel, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.CliConnection.GetApps()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin/models"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("locked connection", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		interval      time.Duration
+		mutex         sync.Mutex
+		running       int
+		overlaps      int
+	)
+	BeforeEach(func() {
+		interval = poll_interval
+		poll_interval = time.Millisecond
+		running = 0
+		overlaps = 0
+		//counts calls that run while another one is still in the rpc
+		enter := func() {
+			mutex.Lock()
+			running++
+			if running > 1 {
+				overlaps++
+			}
+			mutex.Unlock()
+			time.Sleep(2 * time.Millisecond)
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+		}
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+			enter()
+			return plugin_models.GetAppModel{Instances: []plugin_models.GetApp_AppInstanceFields{{State: "running"}}}, nil
+		}
+		connection.CliCommandStub = func(args ...string) ([]string, error) {
+			enter()
+			return []string{"OK"}, nil
+		}
+		ExamplePlugin = &SafeScaler{green: &AppProp{name: "shop-v2"}}
+	})
+	AfterEach(func() {
+		ExamplePlugin.stopWatching()
+		poll_interval = interval
+	})
+	It("should keep the crash watcher out of the commands of the deployment", func() {
+		locked := &lockedConnection{CliConnection: connection}
+		ExamplePlugin.watchCrashes(locked, ExamplePlugin.green)
+		for i := 0; i < 20; i++ {
+			locked.CliCommand("scale", "shop-v2", "-i", "2")
+		}
+		ExamplePlugin.stopWatching()
+		Expect(connection.GetAppCallCount()).To(BeNumerically(">", 0))
+		Expect(overlaps).To(Equal(0))
+	})
+})
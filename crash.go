@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//watches the instances of an app in the background and remembers the first crash it sees
+type CrashWatcher struct {
+	app   string
+	stop  chan bool
+	mutex sync.Mutex
+	crash string
+}
+
+type crashEvents struct {
+	Resources []struct {
+		Data struct {
+			ExitDescription string `json:"exit_description"`
+		} `json:"data"`
+	} `json:"resources"`
+}
+
+//starts watching the new app from the moment it runs. the deployment is halted at the next step once it crashed.
+//the connection has to be the locked one the deployment uses
+func (c *SafeScaler) watchCrashes(cliConnection plugin.CliConnection, app *AppProp) {
+	c.stopWatching()
+	c.watcher = &CrashWatcher{app: app.name, stop: make(chan bool)}
+	go c.watcher.watch(cliConnection)
+}
+
+func (c *SafeScaler) stopWatching() {
+	if c.watcher != nil {
+		close(c.watcher.stop)
+		c.watcher = nil
+	}
+}
+
+func (w *CrashWatcher) watch(cliConnection plugin.CliConnection) {
+	for {
+		//instances that can't be looked up are checked again on the next round
+		if model, err := cliConnection.GetApp(w.app); err == nil {
+			for _, val := range model.Instances {
+				if strings.ToUpper(val.State) == instance_crashed {
+					w.mutex.Lock()
+					w.crash = instanceSummary(model.Instances)
+					w.mutex.Unlock()
+					return
+				}
+			}
+		}
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(poll_interval):
+		}
+	}
+}
+
+//summary of the instances when one crashed, empty otherwise
+func (w *CrashWatcher) crashed() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.crash
+}
+
+func (c *SafeScaler) crashed() string {
+	if c.watcher == nil {
+		return ""
+	}
+	return c.watcher.crashed()
+}
+
+//halts the deployment when the new app crashed and moves the routes back to the old app
+func (c *SafeScaler) checkCrashes(cliConnection plugin.CliConnection) error {
+	crash := c.crashed()
+	if crash == "" {
+		return nil
+	}
+	c.stopWatching()
+	return c.abort(cliConnection, "ERROR. "+c.green.name+" crashed\n"+crash+c.crashReason(cliConnection))
+}
+
+//what cloud foundry recorded about the last crash. empty when the audit events can't be read
+func (c *SafeScaler) crashReason(cliConnection plugin.CliConnection) string {
+	guid, err := c.appGuid(cliConnection, c.green)
+	if err != nil || guid == "" {
+		return ""
+	}
+	query := url.Values{}
+	query.Set("types", "audit.app.process.crash")
+	query.Set("target_guids", guid)
+	query.Set("order_by", "-created_at")
+	query.Set("per_page", "1")
+	events := crashEvents{}
+	if err := c.curl(cliConnection, &events, "/v3/audit_events?"+query.Encode()); err != nil || len(events.Resources) == 0 {
+		return ""
+	}
+	return "Crash reason: " + events.Resources[0].Data.ExitDescription + "\n"
+}
+
+//error for waits that notice the crash themselves. the watcher can't interrupt a step that is still running
+func crashError(app string, crash string) error {
+	return errors.New("ERROR. " + app + " crashed\n" + crash)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+	"github.com/cloudfoundry/cli/plugin/models"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("crash watcher", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		interval      time.Duration
+		mutex         sync.Mutex
+		state         string
+		setState      func(value string)
+		prod          Route
+		temp          Route
+	)
+	BeforeEach(func() {
+		interval = poll_interval
+		poll_interval = 5 * time.Millisecond
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.CliCommandReturns([]string{"OK"}, nil)
+		state = "RUNNING"
+		setState = func(value string) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			state = value
+		}
+		connection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return plugin_models.GetAppModel{Name: name, Guid: "green-guid", Instances: []plugin_models.GetApp_AppInstanceFields{
+				{State: "RUNNING"},
+				{State: state, Details: "app instance exited"},
+			}}, nil
+		}
+		connection.CliCommandWithoutTerminalOutputReturns([]string{`{"resources": [{"data": {"exit_description": "APP/PROC/WEB: Exited with status 137 (out of memory)"}}]}`}, nil)
+		prod = Route{host: "shop", domain: "cfapps.io"}
+		temp = Route{host: "temp-shop", domain: "cfapps.io"}
+		ExamplePlugin = &SafeScaler{
+			blue:        &AppProp{name: "shop-v1", routes: []Route{temp}, alive: true},
+			green:       &AppProp{name: "shop-v2", routes: []Route{prod}, alive: true},
+			blue_routes: []Route{prod},
+			temp_routes: []Route{temp},
+		}
+	})
+	AfterEach(func() {
+		ExamplePlugin.stopWatching()
+		poll_interval = interval
+	})
+	It("should see nothing while the new app runs", func() {
+		ExamplePlugin.watchCrashes(connection, ExamplePlugin.green)
+		time.Sleep(30 * time.Millisecond)
+		Expect(ExamplePlugin.crashed()).To(Equal(""))
+		Expect(ExamplePlugin.checkCrashes(connection)).To(BeNil())
+	})
+	It("should remember the crashed instance", func() {
+		ExamplePlugin.watchCrashes(connection, ExamplePlugin.green)
+		setState("CRASHED")
+		time.Sleep(30 * time.Millisecond)
+		Expect(ExamplePlugin.crashed()).To(Equal("  #0 RUNNING\n  #1 CRASHED: app instance exited\n"))
+	})
+	It("should halt the pipeline and move the routes back once the new app crashes", func() {
+		ran := []string{}
+		step := func(name string) Step {
+			return Step{name, func(cliConnection plugin.CliConnection) error {
+				ran = append(ran, name)
+				if name == "push" {
+					ExamplePlugin.watchCrashes(cliConnection, ExamplePlugin.green)
+				}
+				if name == "unmap" {
+					setState("CRASHED")
+					time.Sleep(30 * time.Millisecond)
+				}
+				return nil
+			}}
+		}
+		err := ExamplePlugin.runPipeline(connection, []Step{step("push"), step("unmap"), step("powerDown")})
+		Expect(err.Error()).To(Equal("ERROR. shop-v2 crashed\n" +
+			"  #0 RUNNING\n" +
+			"  #1 CRASHED: app instance exited\n" +
+			"Crash reason: APP/PROC/WEB: Exited with status 137 (out of memory)\n" +
+			"ERROR. Deployment was aborted. Production routes are served by shop-v1\n"))
+		Expect(ran).To(Equal([]string{"push", "unmap"}))
+		commands := cliCommands(connection)
+		Expect(commands).To(Equal([]string{
+			"map-route shop-v1 cfapps.io --hostname shop",
+			"unmap-route shop-v2 cfapps.io --hostname shop",
+			"unmap-route shop-v1 cfapps.io --hostname temp-shop",
+			"delete-route cfapps.io --hostname temp-shop -f",
+		}))
+		Expect(ExamplePlugin.watcher).To(BeNil())
+	})
+	It("should stop watching once the pipeline is done", func() {
+		ExamplePlugin.watchCrashes(connection, ExamplePlugin.green)
+		err := ExamplePlugin.runPipeline(connection, []Step{})
+		Expect(err).To(BeNil())
+		Expect(ExamplePlugin.watcher).To(BeNil())
+	})
+})
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//error bodies of the v2 and v3 cloud controller api
+type apiError struct {
+	Description string `json:"description"`
+	Errors      []struct {
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+//runs cf curl against the cloud controller and decodes the json response into result.
+//cf curl succeeds on error responses so the body is checked for api errors too
+func (c *SafeScaler) curl(cliConnection plugin.CliConnection, result interface{}, path string, args ...string) error {
+	output, err := cliConnection.CliCommandWithoutTerminalOutput(append([]string{"curl", path}, args...)...)
+	if err != nil {
+		return err
+	}
+	body := []byte(strings.Join(output, "\n"))
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil
+	}
+	failure := apiError{}
+	if err = json.Unmarshal(body, &failure); err != nil {
+		return err
+	}
+	if failure.Description != "" {
+		return errors.New(failure.Description)
+	}
+	if len(failure.Errors) > 0 {
+		return errors.New(failure.Errors[0].Detail)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(body, result)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//route of the space as returned by the v2 api with its domain and apps inlined
+type spaceRoute struct {
+	Metadata struct {
+		Guid string `json:"guid"`
+	} `json:"metadata"`
+	Entity struct {
+		Host   string `json:"host"`
+		Path   string `json:"path"`
+		Port   int    `json:"port"`
+		Domain struct {
+			Entity struct {
+				Name string `json:"name"`
+			} `json:"entity"`
+		} `json:"domain"`
+		Apps []struct {
+			Entity struct {
+				Name  string `json:"name"`
+				State string `json:"state"`
+			} `json:"entity"`
+		} `json:"apps"`
+	} `json:"entity"`
+}
+
+type spaceRoutes struct {
+	NextUrl   string       `json:"next_url"`
+	Resources []spaceRoute `json:"resources"`
+}
+
+//routes and apps left behind by failed or finished deployments
+type Garbage struct {
+	routes []Route
+	apps   []string
+}
+
+func (c *SafeScaler) gc(cliConnection plugin.CliConnection, args []string) error {
+	f := flag.NewFlagSet("f", flag.ContinueOnError)
+	force_ptr := f.Bool("f", false, "delete without asking for confirmation")
+	dry_run_ptr := f.Bool("dry-run", false, "only show what would be deleted")
+	older_than_ptr := f.Int("older-than", 60, "minutes after which a new app that never went live is abandoned")
+	//a mistyped flag would drop the flags after it, like --dry-run
+	if err := f.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return errors.New("ERROR. " + err.Error() + "\n")
+	}
+	if err := c.getSpace(cliConnection); err != nil {
+		return err
+	}
+	garbage, err := c.findGarbage(cliConnection, time.Duration(*older_than_ptr)*time.Minute)
+	if err != nil {
+		return err
+	}
+	if len(garbage.routes) == 0 && len(garbage.apps) == 0 {
+		fmt.Println("Nothing to clean up in " + c.space)
+		return nil
+	}
+	fmt.Println("Found in " + c.space + ":")
+	for _, val := range garbage.apps {
+		fmt.Println("  app   " + val)
+	}
+	for _, val := range garbage.routes {
+		fmt.Println("  route " + val.name())
+	}
+	if *dry_run_ptr {
+		return nil
+	}
+	if !*force_ptr && !c.confirm("Really delete these apps and routes?") {
+		fmt.Println("Nothing was deleted")
+		return nil
+	}
+	//apps go first so their routes are unmapped by the time the routes are deleted
+	for _, val := range garbage.apps {
+		if err := c.deleteApp(cliConnection, val); err != nil {
+			return err
+		}
+	}
+	for _, val := range garbage.routes {
+		if err := c.deleteRoute(cliConnection, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//finds abandoned new apps that hold no routes besides the plugin's own, and the plugin's routes no app that is
+//kept is mapped to. the plugin's routes are the temp and new app routes it labelled, whatever their hostname
+func (c *SafeScaler) findGarbage(cliConnection plugin.CliConnection, older_than time.Duration) (Garbage, error) {
+	garbage := Garbage{routes: []Route{}, apps: []string{}}
+	apps, err := cliConnection.GetApps()
+	if err != nil {
+		return garbage, errors.New("ERROR. Could not list the apps in " + c.space + "\n")
+	}
+	routes := []spaceRoute{}
+	path := "/v2/spaces/" + c.space_guid + "/routes?inline-relations-depth=1&results-per-page=100"
+	for path != "" {
+		page := spaceRoutes{}
+		if err := c.curl(cliConnection, &page, path); err != nil {
+			return garbage, errors.New("ERROR. Could not list the routes in " + c.space + "\n")
+		}
+		routes = append(routes, page.Resources...)
+		path = page.NextUrl
+	}
+	//a temp- hostname alone doesn't make a route ours, someone else may have picked it. foundations without the v3
+	//metadata api have no labels, so nothing is collected there
+	labelled_routes := map[string]bool{}
+	for _, val := range c.labelled(cliConnection, "/v3/routes", roleSelector(role_green, role_temp)) {
+		if val.Guid != "" {
+			labelled_routes[val.Guid] = true
+		}
+	}
+	ours := func(route spaceRoute) bool {
+		return labelled_routes[route.Metadata.Guid]
+	}
+	//only new and temp apps the plugin labelled are collected. apps it didn't push and retired versions kept for
+	//--retain and safe-scale-rollback are never touched. an app stays unless every route it holds is ours
+	stale := map[string]bool{}
+	for _, val := range c.labelled(cliConnection, "/v3/apps", roleSelector(role_green, role_temp)) {
+		role := val.Metadata.Labels[label_prefix+"role"]
+		if role != role_green && role != role_temp {
+			continue
+		}
+		pushed, err := time.Parse(time.RFC3339, val.Metadata.Annotations[label_prefix+"timestamp"])
+		if err == nil && time.Since(pushed) > older_than {
+			stale[val.Name] = true
+		}
+	}
+	for _, val := range routes {
+		for _, app := range val.Entity.Apps {
+			if !ours(val) {
+				stale[app.Entity.Name] = false
+			}
+		}
+	}
+	for _, val := range apps {
+		if stale[val.Name] {
+			garbage.apps = append(garbage.apps, val.Name)
+		}
+	}
+	for _, val := range routes {
+		if !ours(val) {
+			continue
+		}
+		//routes still in use by an app we keep are left alone
+		in_use := false
+		for _, app := range val.Entity.Apps {
+			in_use = in_use || !stale[app.Entity.Name]
+		}
+		if !in_use {
+			garbage.routes = append(garbage.routes, Route{
+				host:   val.Entity.Host,
+				domain: val.Entity.Domain.Entity.Name,
+				path:   val.Entity.Path,
+				port:   val.Entity.Port,
+			})
+		}
+	}
+	return garbage, nil
+}
+
+func (c *SafeScaler) confirm(question string) bool {
+	input := c.input
+	if input == nil {
+		input = os.Stdin
+	}
+	fmt.Print(question + " [y/N] ")
+	answer, err := bufio.NewReader(input).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func (c *SafeScaler) deleteApp(cliConnection plugin.CliConnection, name string) error {
+	if _, err := cliConnection.CliCommand("delete", name, "-f"); err != nil {
+		return errors.New("ERROR. Could not delete " + name + " from space\n")
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin/models"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const routes_page = `{"next_url": null, "resources": [
+	{"entity": {"host": "shop", "domain": {"entity": {"name": "cfapps.io"}}, "apps": [{"entity": {"name": "shop-v2", "state": "STARTED"}}]}},
+	{"metadata": {"guid": "temp-route-guid"}, "entity": {"host": "temp-shop", "domain": {"entity": {"name": "cfapps.io"}}, "apps": []}},
+	{"metadata": {"guid": "team-route-guid"}, "entity": {"host": "temp-api", "domain": {"entity": {"name": "cfapps.io"}}, "apps": []}},
+	{"entity": {"host": "temp-shop", "domain": {"entity": {"name": "apps.internal"}}, "apps": [{"entity": {"name": "shop-v1", "state": "STOPPED"}}]}},
+	{"entity": {"host": "temp-cart", "domain": {"entity": {"name": "cfapps.io"}}, "apps": [{"entity": {"name": "cart-v1", "state": "STARTED"}}]}},
+	{"entity": {"host": "legacy", "domain": {"entity": {"name": "cfapps.io"}}, "apps": [{"entity": {"name": "legacy", "state": "STOPPED"}}]}},
+	{"metadata": {"guid": "green-route-guid"}, "entity": {"host": "shop-v3", "domain": {"entity": {"name": "cfapps.io"}}, "apps": [{"entity": {"name": "shop-v3", "state": "STARTED"}}]}}
+]}`
+
+const labelled_routes = `{"resources": [{"guid": "green-route-guid"}, {"guid": "temp-route-guid"}]}`
+
+var _ = Describe("garbage collection", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		abandon       func(string, string, time.Time)
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		ExamplePlugin = &SafeScaler{}
+		space_field := plugin_models.SpaceFields{Name: "sandbox", Guid: "space-guid"}
+		connection.GetCurrentSpaceReturns(plugin_models.Space{SpaceFields: space_field}, nil)
+		connection.GetAppsReturns([]plugin_models.GetAppsModel{
+			{Name: "shop-v2", State: "started"},
+			{Name: "shop-v1", State: "stopped"},
+			{Name: "cart-v1", State: "started"},
+			{Name: "legacy", State: "stopped"},
+			{Name: "old", State: "stopped"},
+			{Name: "shop-v3", State: "started"},
+		}, nil)
+		labelled_apps := `{"resources": []}`
+		connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			switch {
+			case strings.HasPrefix(args[1], "/v2/spaces/"):
+				return strings.Split(routes_page, "\n"), nil
+			case strings.HasPrefix(args[1], "/v3/routes"):
+				return []string{labelled_routes}, nil
+			case strings.HasPrefix(args[1], "/v3/apps"):
+				return []string{labelled_apps}, nil
+			}
+			return nil, errors.New("unexpected curl")
+		}
+		abandon = func(name string, role string, pushed time.Time) {
+			labelled_apps = `{"resources": [{"guid": "guid", "name": "` + name + `", "metadata": {"labels": {"safe-scale/role": "` + role + `"}, ` +
+				`"annotations": {"safe-scale/timestamp": "` + pushed.UTC().Format(time.RFC3339) + `"}}}]}`
+		}
+	})
+	It("should find unused temp routes and leave stopped apps it didn't label", func() {
+		ExamplePlugin.getSpace(connection)
+		garbage, err := ExamplePlugin.findGarbage(connection, time.Hour)
+		Expect(err).To(BeNil())
+		Expect(garbage.apps).To(BeEmpty())
+		Expect(garbage.routes).To(Equal([]Route{{host: "temp-shop", domain: "cfapps.io"}}))
+		Expect(connection.CliCommandWithoutTerminalOutputArgsForCall(0)).To(Equal([]string{"curl",
+			"/v2/spaces/space-guid/routes?inline-relations-depth=1&results-per-page=100"}))
+	})
+	It("should leave temp routes it didn't label", func() {
+		ExamplePlugin.getSpace(connection)
+		garbage, err := ExamplePlugin.findGarbage(connection, time.Hour)
+		Expect(err).To(BeNil())
+		Expect(garbage.routes).NotTo(ContainElement(Route{host: "temp-api", domain: "cfapps.io"}))
+	})
+	It("should find new apps that never went live", func() {
+		abandon("shop-v3", role_green, time.Now().Add(-2*time.Hour))
+		ExamplePlugin.getSpace(connection)
+		garbage, err := ExamplePlugin.findGarbage(connection, time.Hour)
+		Expect(err).To(BeNil())
+		Expect(garbage.apps).To(Equal([]string{"shop-v3"}))
+		Expect(garbage.routes).To(ContainElement(Route{host: "shop-v3", domain: "cfapps.io"}))
+	})
+	It("should never delete retired versions", func() {
+		abandon("shop-v1", role_retired, time.Now().Add(-48*time.Hour))
+		ExamplePlugin.getSpace(connection)
+		garbage, err := ExamplePlugin.findGarbage(connection, time.Hour)
+		Expect(err).To(BeNil())
+		Expect(garbage.apps).To(BeEmpty())
+		Expect(garbage.routes).NotTo(ContainElement(Route{host: "temp-shop", domain: "apps.internal"}))
+	})
+	It("should leave new apps that were pushed recently", func() {
+		abandon("shop-v3", role_green, time.Now().Add(-10*time.Minute))
+		ExamplePlugin.getSpace(connection)
+		garbage, err := ExamplePlugin.findGarbage(connection, time.Hour)
+		Expect(err).To(BeNil())
+		Expect(garbage.apps).To(BeEmpty())
+		Expect(garbage.routes).To(HaveLen(1))
+	})
+	It("should fail if it can't list the routes", func() {
+		connection.CliCommandWithoutTerminalOutputReturns([]string{`{"description": "not authorized"}`}, nil)
+		ExamplePlugin.getSpace(connection)
+		_, err := ExamplePlugin.findGarbage(connection, time.Hour)
+		Expect(err.Error()).To(Equal("ERROR. Could not list the routes in sandbox\n"))
+	})
+	It("should fail if it can't list the apps", func() {
+		connection.GetAppsReturns(nil, errors.New("not logged in"))
+		ExamplePlugin.getSpace(connection)
+		_, err := ExamplePlugin.findGarbage(connection, time.Hour)
+		Expect(err.Error()).To(Equal("ERROR. Could not list the apps in sandbox\n"))
+	})
+	It("should only show what it would delete on a dry run", func() {
+		err := ExamplePlugin.gc(connection, []string{"safe-scale-gc", "--dry-run"})
+		Expect(err).To(BeNil())
+		Expect(connection.CliCommandCallCount()).To(Equal(0))
+	})
+	It("should not delete anything when a flag is mistyped", func() {
+		err := ExamplePlugin.gc(connection, []string{"safe-scale-gc", "-f", "--dryrun"})
+		Expect(err.Error()).To(Equal("ERROR. flag provided but not defined: -dryrun\n"))
+		Expect(connection.CliCommandCallCount()).To(Equal(0))
+	})
+	It("should not delete anything unless confirmed", func() {
+		ExamplePlugin.input = strings.NewReader("n\n")
+		err := ExamplePlugin.gc(connection, []string{"safe-scale-gc"})
+		Expect(err).To(BeNil())
+		Expect(connection.CliCommandCallCount()).To(Equal(0))
+	})
+	It("should delete the apps and then the routes once confirmed", func() {
+		abandon("shop-v3", role_green, time.Now().Add(-2*time.Hour))
+		ExamplePlugin.input = strings.NewReader("y\n")
+		err := ExamplePlugin.gc(connection, []string{"safe-scale-gc"})
+		Expect(err).To(BeNil())
+		Expect(connection.CliCommandCallCount()).To(Equal(3))
+		Expect(connection.CliCommandArgsForCall(0)).To(Equal([]string{"delete", "shop-v3", "-f"}))
+		Expect(connection.CliCommandArgsForCall(2)).To(Equal([]string{"delete-route", "cfapps.io", "--hostname", "shop-v3", "-f"}))
+	})
+	It("should delete without asking when forced", func() {
+		err := ExamplePlugin.gc(connection, []string{"safe-scale-gc", "-f"})
+		Expect(err).To(BeNil())
+		Expect(connection.CliCommandCallCount()).To(Equal(1))
+	})
+	It("should fail if it can't delete an app", func() {
+		abandon("shop-v3", role_green, time.Now().Add(-2*time.Hour))
+		connection.CliCommandReturns(nil, errors.New("could not delete"))
+		err := ExamplePlugin.gc(connection, []string{"safe-scale-gc", "-f"})
+		Expect(err.Error()).To(Equal("ERROR. Could not delete shop-v3 from space\n"))
+	})
+})
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+	"github.com/cloudfoundry/cli/plugin/models"
+)
+
+//instance states as reported by GetApp. older clis report them in lower case
+const (
+	instance_running = "RUNNING"
+	instance_crashed = "CRASHED"
+)
+
+//waits for every requested instance of the app to be running. cf push can return while instances are still
+//starting, so the health test would only reach some of them
+func (c *SafeScaler) awaitInstances(cliConnection plugin.CliConnection, app *AppProp) error {
+	fmt.Println("Waiting for the instances of " + app.name + " to start")
+	base := time.Now()
+	for {
+		model, err := cliConnection.GetApp(app.name)
+		if err != nil {
+			return errors.New("ERROR. Could not access " + app.name + " in Cloud Foundry\n")
+		}
+		running := 0
+		for _, val := range model.Instances {
+			switch strings.ToUpper(val.State) {
+			case instance_running:
+				running++
+			case instance_crashed:
+				return errors.New("ERROR. An instance of " + app.name + " crashed while starting\n" + instanceSummary(model.Instances))
+			}
+		}
+		if running >= model.InstanceCount {
+			return nil
+		}
+		if time.Since(base) > time.Duration(c.start_timeout)*time.Second {
+			return errors.New("ERROR. " + fmt.Sprint(running) + " of " + fmt.Sprint(model.InstanceCount) + " instances of " + app.name + " are running after " + fmt.Sprint(c.start_timeout) + " seconds\n" + instanceSummary(model.Instances))
+		}
+		time.Sleep(poll_interval)
+	}
+}
+
+//one line per instance with its state and what cf says about it
+func instanceSummary(instances []plugin_models.GetApp_AppInstanceFields) string {
+	summary := ""
+	for i, val := range instances {
+		line := "  #" + fmt.Sprint(i) + " " + strings.ToUpper(val.State)
+		if !val.Since.IsZero() {
+			line += " since " + val.Since.UTC().Format(time.RFC3339)
+		}
+		if val.Details != "" {
+			line += ": " + val.Details
+		}
+		summary += line + "\n"
+	}
+	return summary
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin/models"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("instances", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		interval      time.Duration
+		models        []plugin_models.GetAppModel
+		app           func(states ...string) plugin_models.GetAppModel
+	)
+	BeforeEach(func() {
+		interval = poll_interval
+		poll_interval = 10 * time.Millisecond
+		connection = &pluginfakes.FakeCliConnection{}
+		models = []plugin_models.GetAppModel{}
+		connection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+			model := models[0]
+			if len(models) > 1 {
+				models = models[1:]
+			}
+			return model, nil
+		}
+		app = func(states ...string) plugin_models.GetAppModel {
+			model := plugin_models.GetAppModel{Name: "shop-v2", InstanceCount: 3}
+			for _, val := range states {
+				model.Instances = append(model.Instances, plugin_models.GetApp_AppInstanceFields{State: val})
+			}
+			return model
+		}
+		ExamplePlugin = &SafeScaler{
+			green:         &AppProp{name: "shop-v2"},
+			start_timeout: 5,
+		}
+	})
+	AfterEach(func() {
+		poll_interval = interval
+	})
+	It("should wait until every requested instance is running", func() {
+		models = []plugin_models.GetAppModel{
+			app("starting"),
+			app("running", "starting", "starting"),
+			app("running", "running", "running"),
+		}
+		err := ExamplePlugin.awaitInstances(connection, ExamplePlugin.green)
+		Expect(err).To(BeNil())
+		Expect(connection.GetAppCallCount()).To(Equal(3))
+	})
+	It("should fail with a summary as soon as an instance crashes", func() {
+		crashed := app("RUNNING", "STARTING", "RUNNING")
+		crashed.Instances = append(crashed.Instances[:1], plugin_models.GetApp_AppInstanceFields{
+			State:   "CRASHED",
+			Details: "out of memory",
+			Since:   time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+		}, crashed.Instances[2])
+		models = []plugin_models.GetAppModel{app("starting"), crashed}
+		err := ExamplePlugin.awaitInstances(connection, ExamplePlugin.green)
+		Expect(err.Error()).To(Equal("ERROR. An instance of shop-v2 crashed while starting\n" +
+			"  #0 RUNNING\n" +
+			"  #1 CRASHED since 2026-10-19T12:00:00Z: out of memory\n" +
+			"  #2 RUNNING\n"))
+	})
+	It("should fail when instances are stuck starting past the deadline", func() {
+		ExamplePlugin.start_timeout = 0
+		models = []plugin_models.GetAppModel{app("running", "starting", "starting")}
+		err := ExamplePlugin.awaitInstances(connection, ExamplePlugin.green)
+		Expect(err.Error()).To(Equal("ERROR. 1 of 3 instances of shop-v2 are running after 0 seconds\n" +
+			"  #0 RUNNING\n" +
+			"  #1 STARTING\n" +
+			"  #2 STARTING\n"))
+	})
+	It("should fail when the app can't be found", func() {
+		connection.GetAppStub = nil
+		connection.GetAppReturns(plugin_models.GetAppModel{}, errors.New("not found"))
+		err := ExamplePlugin.awaitInstances(connection, ExamplePlugin.green)
+		Expect(err.Error()).To(Equal("ERROR. Could not access shop-v2 in Cloud Foundry\n"))
+	})
+	It("should not health test the new app before its instances run", func() {
+		models = []plugin_models.GetAppModel{app("running", "crashed", "running")}
+		ExamplePlugin.test = "/health"
+		err := ExamplePlugin.checkHealth(connection)
+		Expect(err.Error()).To(HavePrefix("ERROR. An instance of shop-v2 crashed while starting\n"))
+	})
+})
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//prefix of the metadata labels and annotations the plugin sets
+const label_prefix = "safe-scale/"
+
+//roles an app or route plays in a deployment
+const (
+	role_blue    = "blue"
+	role_green   = "green"
+	role_live    = "live"
+	role_retired = "retired"
+	role_temp    = "temp"
+)
+
+//characters cf doesn't allow in label values
+var label_invalid = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+type Metadata struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type resourceList struct {
+	Resources []struct {
+		Guid string `json:"guid"`
+		Host string `json:"host"`
+		Path string `json:"path"`
+		Port int    `json:"port"`
+	} `json:"resources"`
+}
+
+type labelledResource struct {
+	Guid     string   `json:"guid"`
+	Name     string   `json:"name"`
+	Metadata Metadata `json:"metadata"`
+}
+
+type labelledResources struct {
+	Resources []labelledResource `json:"resources"`
+}
+
+//sorts the newest deployment first. deployment ids start with their timestamp
+type byDeployment []labelledResource
+
+func (d byDeployment) Len() int      { return len(d) }
+func (d byDeployment) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d byDeployment) Less(i, j int) bool {
+	return d[i].Metadata.Labels[label_prefix+"deployment"] > d[j].Metadata.Labels[label_prefix+"deployment"]
+}
+
+func roleSelector(roles ...string) string {
+	return label_prefix + "role in (" + strings.Join(roles, ",") + ")"
+}
+
+//resources of the space matching the label selector. empty when the api has no metadata support
+func (c *SafeScaler) labelled(cliConnection plugin.CliConnection, path string, selector string) []labelledResource {
+	query := url.Values{}
+	query.Set("space_guids", c.space_guid)
+	query.Set("label_selector", selector)
+	query.Set("per_page", "5000")
+	resources := labelledResources{}
+	if err := c.curl(cliConnection, &resources, path+"?"+query.Encode()); err != nil {
+		return []labelledResource{}
+	}
+	return resources.Resources
+}
+
+func newDeploymentId() string {
+	return time.Now().UTC().Format("20060102-150405") + "-" + randomString()
+}
+
+func labelValue(value string) string {
+	value = label_invalid.ReplaceAllString(value, "-")
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.Trim(value, "-_.")
+}
+
+//name that identifies the app across deployments. it is handed down from the old app's label and starts out
+//as the name of the first app deployed
+func (c *SafeScaler) appName(cliConnection plugin.CliConnection) string {
+	if c.logical != "" {
+		return c.logical
+	}
+	c.logical = labelValue(c.blue.name)
+	resource := labelledResource{}
+	if c.blue.guid != "" && c.curl(cliConnection, &resource, "/v3/apps/"+c.blue.guid) == nil {
+		if name := resource.Metadata.Labels[label_prefix+"app"]; name != "" {
+			c.logical = name
+		}
+	}
+	return c.logical
+}
+
+//labels and annotations describing the deployment and the role the resource plays in it
+func (c *SafeScaler) metadata(cliConnection plugin.CliConnection, role string) Metadata {
+	user, _ := cliConnection.Username()
+	return Metadata{
+		Labels: map[string]string{
+			label_prefix + "app":        c.appName(cliConnection),
+			label_prefix + "deployment": c.deployment,
+			label_prefix + "role":       role,
+			label_prefix + "source-app": labelValue(c.blue.name),
+		},
+		Annotations: map[string]string{
+			label_prefix + "source-app": c.blue.name,
+			label_prefix + "timestamp":  time.Now().UTC().Format(time.RFC3339),
+			label_prefix + "user":       user,
+		},
+	}
+}
+
+//labels are best effort. foundations without the v3 metadata api still get deployed to
+func (c *SafeScaler) labelApp(cliConnection plugin.CliConnection, app *AppProp, role string) {
+	if c.deployment == "" {
+		return
+	}
+	if err := c.setAppMetadata(cliConnection, app, c.metadata(cliConnection, role)); err != nil {
+		fmt.Println("WARNING. Could not label " + app.name + " as " + role + ". " + err.Error())
+	}
+}
+
+func (c *SafeScaler) labelRoute(cliConnection plugin.CliConnection, route Route, role string) {
+	if c.deployment == "" {
+		return
+	}
+	if err := c.setRouteMetadata(cliConnection, route, c.metadata(cliConnection, role)); err != nil {
+		fmt.Println("WARNING. Could not label " + route.name() + " route as " + role + ". " + err.Error())
+	}
+}
+
+func (c *SafeScaler) setAppMetadata(cliConnection plugin.CliConnection, app *AppProp, metadata Metadata) error {
+	guid, err := c.appGuid(cliConnection, app)
+	if err != nil {
+		return err
+	}
+	return c.patchMetadata(cliConnection, "/v3/apps/"+guid, metadata)
+}
+
+//guid of the app. the new app only gets one once it is pushed so it is looked up the first time it is needed
+func (c *SafeScaler) appGuid(cliConnection plugin.CliConnection, app *AppProp) (string, error) {
+	if app.guid == "" {
+		model, err := cliConnection.GetApp(app.name)
+		if err != nil {
+			return "", err
+		}
+		app.guid = model.Guid
+	}
+	return app.guid, nil
+}
+
+func (c *SafeScaler) setRouteMetadata(cliConnection plugin.CliConnection, route Route, metadata Metadata) error {
+	guid, err := c.routeGuid(cliConnection, route)
+	if err != nil {
+		return err
+	}
+	return c.patchMetadata(cliConnection, "/v3/routes/"+guid, metadata)
+}
+
+func (c *SafeScaler) patchMetadata(cliConnection plugin.CliConnection, path string, metadata Metadata) error {
+	body, err := json.Marshal(map[string]Metadata{"metadata": metadata})
+	if err != nil {
+		return err
+	}
+	return c.curl(cliConnection, nil, path, "-X", "PATCH", "-d", string(body))
+}
+
+func (c *SafeScaler) routeGuid(cliConnection plugin.CliConnection, route Route) (string, error) {
+	domains := resourceList{}
+	if err := c.curl(cliConnection, &domains, "/v3/domains?names="+url.QueryEscape(route.domain)); err != nil {
+		return "", err
+	}
+	if len(domains.Resources) == 0 {
+		return "", errors.New("domain " + route.domain + " not found")
+	}
+	query := url.Values{}
+	query.Set("domain_guids", domains.Resources[0].Guid)
+	query.Set("space_guids", c.space_guid)
+	if route.host != "" {
+		query.Set("hosts", route.host)
+	}
+	routes := resourceList{}
+	if err := c.curl(cliConnection, &routes, "/v3/routes?"+query.Encode()); err != nil {
+		return "", err
+	}
+	for _, val := range routes.Resources {
+		if val.Host == route.host && val.Path == route.path && val.Port == route.port {
+			return val.Guid, nil
+		}
+	}
+	return "", errors.New("route not found")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin/models"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("labels", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		patches       map[string]Metadata
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		ExamplePlugin = &SafeScaler{deployment: "20161018-120000-abc123", space_guid: "space-guid"}
+		ExamplePlugin.blue = &AppProp{name: "shop", guid: "blue-guid"}
+		connection.UsernameReturns("admin", nil)
+		connection.GetAppReturns(plugin_models.GetAppModel{Guid: "green-guid"}, nil)
+		patches = map[string]Metadata{}
+		connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			switch {
+			case strings.HasPrefix(args[1], "/v3/domains?"):
+				return []string{`{"resources": [{"guid": "domain-guid"}]}`}, nil
+			case args[1] == "/v3/routes?domain_guids=domain-guid&hosts=shop&space_guids=space-guid":
+				return []string{`{"resources": [{"guid": "other-guid", "host": "shop", "path": "/api"}, {"guid": "route-guid", "host": "shop", "path": ""}]}`}, nil
+			case len(args) == 6 && args[2] == "-X" && args[3] == "PATCH":
+				body := map[string]Metadata{}
+				json.Unmarshal([]byte(args[5]), &body)
+				patches[args[1]] = body["metadata"]
+				return []string{`{}`}, nil
+			}
+			return []string{`{"resources": []}`}, nil
+		}
+	})
+	It("should label an app with the deployment and its role", func() {
+		green := &AppProp{name: "shop-v2"}
+		ExamplePlugin.labelApp(connection, green, role_green)
+		Expect(green.guid).To(Equal("green-guid"))
+		Expect(patches).To(HaveKey("/v3/apps/green-guid"))
+		Expect(patches["/v3/apps/green-guid"].Labels).To(Equal(map[string]string{
+			"safe-scale/app":        "shop",
+			"safe-scale/deployment": "20161018-120000-abc123",
+			"safe-scale/role":       "green",
+			"safe-scale/source-app": "shop",
+		}))
+		Expect(patches["/v3/apps/green-guid"].Annotations["safe-scale/user"]).To(Equal("admin"))
+		Expect(patches["/v3/apps/green-guid"].Annotations).To(HaveKey("safe-scale/timestamp"))
+	})
+	It("should label the route matching host and path", func() {
+		ExamplePlugin.labelRoute(connection, Route{host: "shop", domain: "cfapps.io"}, role_live)
+		Expect(patches).To(HaveKey("/v3/routes/route-guid"))
+		Expect(patches["/v3/routes/route-guid"].Labels["safe-scale/role"]).To(Equal("live"))
+	})
+	It("should not label anything outside of a deployment", func() {
+		ExamplePlugin.deployment = ""
+		ExamplePlugin.labelApp(connection, ExamplePlugin.blue, role_blue)
+		Expect(connection.CliCommandWithoutTerminalOutputCallCount()).To(Equal(0))
+	})
+	It("should carry on when the api has no metadata support", func() {
+		connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			return nil, errors.New("404 Not Found")
+		}
+		ExamplePlugin.labelApp(connection, ExamplePlugin.blue, role_retired)
+		ExamplePlugin.labelRoute(connection, Route{host: "shop", domain: "cfapps.io"}, role_live)
+	})
+	It("should hand down the app name from the old app", func() {
+		stub := connection.CliCommandWithoutTerminalOutputStub
+		connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			if len(args) == 2 && args[1] == "/v3/apps/blue-guid" {
+				return []string{`{"guid": "blue-guid", "metadata": {"labels": {"safe-scale/app": "storefront"}}}`}, nil
+			}
+			return stub(args...)
+		}
+		ExamplePlugin.labelApp(connection, ExamplePlugin.blue, role_blue)
+		Expect(patches["/v3/apps/blue-guid"].Labels["safe-scale/app"]).To(Equal("storefront"))
+		Expect(patches["/v3/apps/blue-guid"].Labels["safe-scale/source-app"]).To(Equal("shop"))
+	})
+	It("should make app names valid label values", func() {
+		Expect(labelValue("my app (v2)")).To(Equal("my-app--v2"))
+		Expect(labelValue(strings.Repeat("a", 70))).To(HaveLen(63))
+	})
+})
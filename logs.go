@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//layout of the timestamp cf logs puts in front of every line
+const log_time_layout = "2006-01-02T15:04:05.00-0700"
+
+//adds the recent logs of the new app to the error of a failed step so the failure can be diagnosed from the output
+//of the deployment alone. the old app's logs are added when it failed to drain
+func (c *SafeScaler) attachLogs(cliConnection plugin.CliConnection, step string, cause error) error {
+	//nothing to show before the new app was pushed
+	if c.green == nil || !c.green.alive {
+		return cause
+	}
+	apps := []*AppProp{c.green}
+	if step == step_drain && c.blue != nil && c.blue != c.green {
+		apps = append(apps, c.blue)
+	}
+	message := cause.Error()
+	for _, app := range apps {
+		message += c.recentLogs(cliConnection, app)
+	}
+	return errors.New(message)
+}
+
+//logs of the app since the deployment started, printed or saved to --logs-dir
+func (c *SafeScaler) recentLogs(cliConnection plugin.CliConnection, app *AppProp) string {
+	output, err := cliConnection.CliCommandWithoutTerminalOutput("logs", app.name, "--recent")
+	if err != nil {
+		return "WARNING. Could not get the recent logs of " + app.name + "\n"
+	}
+	lines := filterLogs(output, c.started)
+	if len(lines) == 0 {
+		return ""
+	}
+	//apps can log the credentials they were sent
+	logs := c.redact(strings.Join(lines, "\n") + "\n")
+	if c.logs_dir == "" {
+		return "Recent logs of " + app.name + ":\n" + logs
+	}
+	path := filepath.Join(c.logs_dir, app.name+"-"+c.deployment+".log")
+	if err := ioutil.WriteFile(path, []byte(logs), 0644); err != nil {
+		return "WARNING. Could not save the logs of " + app.name + " to " + path + "\n"
+	}
+	return "Logs of " + app.name + " were saved to " + path + "\n"
+}
+
+//lines logged since the given time. lines without a timestamp, like stack traces, belong to the line before them
+func filterLogs(output []string, since time.Time) []string {
+	lines := []string{}
+	keep := false
+	for _, val := range strings.Split(strings.Join(output, "\n"), "\n") {
+		fields := strings.Fields(val)
+		if len(fields) > 0 {
+			if stamp, err := time.Parse(log_time_layout, fields[0]); err == nil {
+				keep = !stamp.Before(since)
+			}
+		}
+		if keep && strings.TrimSpace(val) != "" {
+			lines = append(lines, strings.TrimRight(val, " \r"))
+		}
+	}
+	return lines
+}
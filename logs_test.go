@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("logs", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		logs          map[string][]string
+		failing       func(name string) Step
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.CliCommandReturns([]string{"OK"}, nil)
+		logs = map[string][]string{
+			"shop-v2": {
+				"Retrieving logs for app shop-v2 in org org / space sandbox as admin...",
+				"",
+				"   2026-10-19T11:59:58.00+0000 [API/0] OUT Updated app with guid green-guid",
+				"   2026-10-19T12:00:01.00+0000 [APP/PROC/WEB/0] ERR panic: database is locked",
+				"   goroutine 1 [running]:",
+				"   2026-10-19T12:00:02.00+0000 [CELL/0] OUT Exit status 2",
+			},
+			"shop-v1": {
+				"   2026-10-19T12:00:03.00+0000 [APP/PROC/WEB/1] OUT 3 transactions pending",
+			},
+		}
+		connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			if args[0] != "logs" || args[2] != "--recent" {
+				return nil, errors.New("unexpected command")
+			}
+			return logs[args[1]], nil
+		}
+		failing = func(name string) Step {
+			return Step{name, func(cliConnection plugin.CliConnection) error {
+				return errors.New("ERROR. " + name + " failed\n")
+			}}
+		}
+		ExamplePlugin = &SafeScaler{
+			blue:       &AppProp{name: "shop-v1", alive: true},
+			green:      &AppProp{name: "shop-v2", alive: true},
+			deployment: "20261019-120000-abcdef",
+			started:    time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+		}
+	})
+	It("should keep the lines logged since the deployment started", func() {
+		lines := filterLogs(logs["shop-v2"], ExamplePlugin.started)
+		Expect(lines).To(Equal([]string{
+			"   2026-10-19T12:00:01.00+0000 [APP/PROC/WEB/0] ERR panic: database is locked",
+			"   goroutine 1 [running]:",
+			"   2026-10-19T12:00:02.00+0000 [CELL/0] OUT Exit status 2",
+		}))
+	})
+	It("should print the logs of the new app with the error of a failed step", func() {
+		err := ExamplePlugin.runPipeline(connection, []Step{failing("health")})
+		Expect(err.Error()).To(Equal("ERROR. health failed\n" +
+			"Recent logs of shop-v2:\n" +
+			"   2026-10-19T12:00:01.00+0000 [APP/PROC/WEB/0] ERR panic: database is locked\n" +
+			"   goroutine 1 [running]:\n" +
+			"   2026-10-19T12:00:02.00+0000 [CELL/0] OUT Exit status 2\n"))
+	})
+	It("should add the logs of the old app when it failed to drain", func() {
+		err := ExamplePlugin.runPipeline(connection, []Step{failing("drain")})
+		Expect(err.Error()).To(HavePrefix("ERROR. drain failed\nRecent logs of shop-v2:\n"))
+		Expect(err.Error()).To(ContainSubstring("Recent logs of shop-v1:\n   2026-10-19T12:00:03.00+0000 [APP/PROC/WEB/1] OUT 3 transactions pending\n"))
+	})
+	It("should not look for logs before the new app was pushed", func() {
+		ExamplePlugin.green.alive = false
+		err := ExamplePlugin.runPipeline(connection, []Step{failing("push")})
+		Expect(err.Error()).To(Equal("ERROR. push failed\n"))
+		Expect(connection.CliCommandWithoutTerminalOutputCallCount()).To(Equal(0))
+	})
+	It("should save the logs to the logs directory", func() {
+		dir, _ := ioutil.TempDir("", "logs")
+		defer os.RemoveAll(dir)
+		ExamplePlugin.logs_dir = dir
+		err := ExamplePlugin.runPipeline(connection, []Step{failing("map")})
+		path := filepath.Join(dir, "shop-v2-20261019-120000-abcdef.log")
+		Expect(err.Error()).To(Equal("ERROR. map failed\nLogs of shop-v2 were saved to " + path + "\n"))
+		content, _ := ioutil.ReadFile(path)
+		Expect(string(content)).To(ContainSubstring("panic: database is locked"))
+	})
+	It("should still fail with the step's error when the logs can't be read", func() {
+		connection.CliCommandWithoutTerminalOutputStub = nil
+		connection.CliCommandWithoutTerminalOutputReturns(nil, errors.New("no logs"))
+		err := ExamplePlugin.runPipeline(connection, []Step{failing("map")})
+		Expect(err.Error()).To(Equal("ERROR. map failed\nWARNING. Could not get the recent logs of shop-v2\n"))
+	})
+})
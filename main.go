@@ -8,71 +8,263 @@ import (
 	"flag"
 	"errors"
 	"strconv"
+	"io"
+	"strings"
 )
 
+//time between two requests to an endpoint that is being monitored
+var poll_interval = 3 * time.Second
+
 type SafeScaler struct {
 	blue         *AppProp
 	green        *AppProp
 	green_routes []Route
 	blue_routes  []Route
+	temp_routes  []Route
 	services     []string
 	trans        string
 	test         string
 	inst         string
 	timeout      int
+	probe_domain string
+	route_suffix string
+	reuse_routes bool
+	bake         int
+	canary_steps int
+	canary_hold  int
+	weights      []int
+	strategy     string
+	maintenance  string
+	standby      *AppProp
+	pre_hooks    Hooks
+	post_hooks   Hooks
+	pre_switch_task string
+	task_timeout int
+	start_timeout int
+	watcher      *CrashWatcher
+	logs_dir     string
+	started      time.Time
+	mapped       time.Time
+	error_margin float64
+	latency_margin int
+	metrics      MetricChecks
+	metrics_path string
+	prober       *Prober
+	probe_rate   float64
+	probe_path   string
+	probe_fail   bool
+	verify_routes bool
+	verify_header string
+	verify_path  string
+	verify_attempts int
+	expect_version string
+	version_endpoint string
+	version_path string
+	warmup_file  string
+	warmup_concurrency int
+	warmup_duration int
+	connect_timeout int
+	read_timeout int
+	skip_ssl_validation bool
+	ca_cert      string
+	client_cert  string
+	client_key   string
+	proxy        string
+	scheme       string
+	headers      Headers
+	basic_auth   string
+	bearer_token string
+	cf_token     bool
+	secrets      *Secrets
+	replaced     bool //an in-place strategy pushed the new code over the old code
+	retired      *Metadata //labels of the retired version a rollback started
+	probe_app    string
+	probe_instance int
+	probe_port   int
+	internal_domains map[string]bool
+	allowed      []*AppProp //apps this run added a network policy from --probe-app to
+	rename       bool
+	delete_old   bool
+	retain       int
+	logical      string
 	space        string
+	space_guid   string
+	deployment   string
 	client       *http.Client
+	input        io.Reader
 }
 type AppProp struct {
-	name   string
-	routes []Route
-	alive  bool
+	name      string
+	guid      string
+	routes    []Route
+	alive     bool
+	instances int
+	scaled    int //instances a canary scaled the app to, 0 while it runs as many as it was found with
+	reachable bool //--probe-app has a network policy to the app
+}
+func (a *AppProp) hasRoute(route Route) bool {
+	for _, value := range a.routes {
+		if value == route {
+			return true
+		}
+	}
+	return false
+}
+
+//updating app routes array
+func (a *AppProp) dropRoute(route Route) {
+	for i, value := range a.routes {
+		if value == route {
+			new_routes := append(a.routes[:i], a.routes[i + 1:]...)
+			a.routes = new_routes
+			break
+		}
+	}
 }
+
 type Route struct {
 	host   string
 	domain string
+	path   string
+	port   int
+}
+
+//flags that identify the route to the cf route commands. hostless and tcp routes leave out --hostname
+func (r Route) flags() []string {
+	flags := []string{}
+	if r.host != "" {
+		flags = append(flags, "--hostname", r.host)
+	}
+	if r.path != "" {
+		flags = append(flags, "--path", r.path)
+	}
+	if r.port != 0 {
+		flags = append(flags, "--port", strconv.Itoa(r.port))
+	}
+	return flags
+}
+
+//name of the route used in messages
+func (r Route) name() string {
+	name := r.domain
+	if r.host != "" {
+		name += "." + r.host
+	}
+	if r.port != 0 {
+		name += ":" + strconv.Itoa(r.port)
+	}
+	return name + r.path
+}
+
+//host, port and path the route is reached on
+func (r Route) address() string {
+	address := r.domain
+	if r.host != "" {
+		address = r.host + "." + address
+	}
+	if r.port != 0 {
+		address += ":" + strconv.Itoa(r.port)
+	}
+	return address + r.path
+}
+
+//url of an endpoint served behind the route, requested with --scheme. internal routes are requested from the
+//--probe-app instance on the container port of the app, which doesn't speak tls
+func (c *SafeScaler) url(route Route, endpoint string) string {
+	if c.internal_domains[route.domain] && route.port == 0 {
+		route.port = c.probe_port
+		return "http://" + route.address() + endpoint
+	}
+	scheme := c.scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	return scheme + "://" + route.address() + endpoint
 }
 
 func (c *SafeScaler) Run(cliConnection plugin.CliConnection, args []string) {
-	if args[0] != "safe-scale" {
+	//the crash watcher shares the connection with the deployment
+	cliConnection = &lockedConnection{CliConnection: cliConnection}
+	if args[0] == "safe-scale-gc" {
+		if err := c.gc(cliConnection, args); err != nil {
+			fmt.Println(err)
+		}
 		return
 	}
-	if err := c.getArgs(args); err != nil {
-		fmt.Println(err)
+	if args[0] == "safe-scale-rollback" {
+		if err := c.rollback(cliConnection, args); err != nil {
+			fmt.Println(c.redact(err.Error()))
+		}
 		return
 	}
-	if err := c.getApp(cliConnection, args); err != nil {
-		fmt.Println(err)
+	if args[0] != "safe-scale" {
 		return
 	}
-	if err := c.createNewApp(cliConnection); err != nil {
+	if err := c.getArgs(args); err != nil {
 		fmt.Println(err)
 		return
 	}
-	c.client = http.DefaultClient //client for endpoint monitoring
-	if healthy := c.healthTest(c.client); !healthy {
-		fmt.Println("ERROR. new app is not healthy. Can not continue blue-green deployment. Routes from old app will not be transferred to new app\n")
-		return
-	}
-	if err := c.mapping(cliConnection); err != nil {
+	c.deployment = newDeploymentId()
+	client, err := c.newClient() //client for endpoint monitoring
+	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	if err := c.unmapping(cliConnection); err != nil {
+	if err := c.authorize(cliConnection, client); err != nil {
 		fmt.Println(err)
 		return
 	}
-	if err := c.monitorTransactions(c.client); err != nil {
+	c.client = client
+	strategy, err := c.getStrategy()
+	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	if err := c.powerDown(cliConnection); err != nil {
-		fmt.Println(err)
+	get_app := Step{step_get_app, func(cliConnection plugin.CliConnection) error {
+		return c.getApp(cliConnection, args)
+	}}
+	if err := c.runPipeline(cliConnection, append([]Step{get_app}, strategy.Steps()...)); err != nil {
+		fmt.Println(c.redact(err.Error()))
 		return
 	}
 
 }
 
+//steps that move the routes from the old app to the healthy new app and retire the old app once it has drained
+func (c *SafeScaler) cutoverSteps() []Step {
+	return []Step{
+		{step_health, c.checkHealth},
+		{step_warmup, c.warmUp},
+		//the production routes are probed from mapping until the old app is stopped
+		{step_map, func(cliConnection plugin.CliConnection) error {
+			c.startProbing(c.client)
+			return c.mapping(cliConnection)
+		}},
+		{step_canary, func(cliConnection plugin.CliConnection) error {
+			return c.canary(cliConnection, c.client)
+		}},
+		{step_analysis, c.compareAccessLogs},
+		{step_verify, c.verifyRoutes},
+		{step_unmap, c.unmapping},
+		{step_bake, func(cliConnection plugin.CliConnection) error {
+			return c.bakeNewApp(cliConnection, c.client)
+		}},
+		{step_drain, func(cliConnection plugin.CliConnection) error {
+			return c.monitorTransactions(c.client)
+		}},
+		//the new app is watched until the old app is gone
+		{step_power_down, func(cliConnection plugin.CliConnection) error {
+			defer c.stopWatching()
+			if err := c.powerDown(cliConnection); err != nil {
+				return err
+			}
+			return c.finishProbing()
+		}},
+		{step_rename, c.renameApps},
+		{step_prune, c.pruneRetired},
+	}
+}
+
 func (c *SafeScaler) GetMetadata() plugin.PluginMetadata {
 	return plugin.PluginMetadata{
 		Name: "safe_scale",
@@ -91,12 +283,93 @@ func (c *SafeScaler) GetMetadata() plugin.PluginMetadata {
 				Name: "safe-scale",
 				HelpText: "Safely scales down your application using blue green deployment",
 				UsageDetails: plugin.Usage{
-					Usage: "safe-scale\n	cf safe-scale app_name new_app_name [--i] [--trans] [--test] [--timeout]",
+					Usage: "safe-scale\n	cf safe-scale app_name new_app_name [--i] [--trans] [--test] [--timeout] [--probe-domain] [--route-suffix] [--reuse-routes] [--bake] [--canary-steps] [--canary-hold] [--weights] [--error-margin] [--latency-margin] [--metric] [--metrics-path] [--probe-rate] [--probe-path] [--probe-fail] [--verify-routes] [--verify-header] [--verify-path] [--verify-attempts] [--expect-version] [--version-endpoint] [--version-path] [--warmup-file] [--warmup-concurrency] [--warmup-duration] [--connect-timeout] [--read-timeout] [--skip-ssl-validation] [--ca-cert] [--client-cert] [--client-key] [--proxy] [--scheme] [--header] [--basic-auth] [--bearer-token] [--cf-token] [--probe-app] [--probe-instance] [--probe-port] [--retain] [--strategy] [--start-timeout] [--pre-switch-task] [--task-timeout] [--logs-dir] [--pre-hook] [--post-hook]\n	cf safe-scale app_name --rename [--delete-old] [...]\n	cf safe-scale app_name --strategy rolling|recreate [--maintenance-app] [...]",
 					Options: map[string]string{
 						"--i":        "number of instances for new app",
 						"-trans":        "endpoint to monitor transactions",
 						"-test":        "endpoint to test if new app is healthy",
 						"-timeout":        "time in seconds to monitor transactions",
+						"-probe-domain":        "domain the health and transaction endpoints are reached on",
+						"-route-suffix":        "suffix for the temp and new app hostnames, {random} adds random characters",
+						"-reuse-routes":        "reuse temp routes left behind by a previous run",
+						"-rename":        "push the new app next to app_name and give it the name once it is live",
+						"-delete-old":        "with --rename, delete the old app instead of keeping it under a new name",
+						"-retain":        "number of retired versions to keep, -1 keeps all of them",
+						"-bake":        "time in seconds to watch the new app on the production routes before draining the old app",
+						"-canary-steps":        "start the new app with 1 instance and shift instances over from the old app in this many stages",
+						"-canary-hold":        "time in seconds to hold each canary stage while checks run",
+						"-weights":        "percentages of traffic to shift to the new app with route weights, e.g. 5,25,50,100",
+						"-error-margin":        "percentage points the router 5xx rate of the new app may exceed the old app's by before the old app is unmapped",
+						"-latency-margin":        "milliseconds the router p99 latency of the new app may exceed the old app's by before the old app is unmapped",
+						"-metric":        "query:margin the new app's prometheus metric may exceed the old app's by during the bake, can be repeated",
+						"-metrics-path":        "endpoint path the apps serve prometheus metrics on, defaults to /metrics",
+						"-probe-rate":        "requests a second to send to every production route from mapping until the old app is stopped",
+						"-probe-path":        "endpoint path to probe the production routes on, defaults to /",
+						"-probe-fail":        "fail the deployment when a probe of the production routes failed",
+						"-verify-routes":        "make sure the new app answers on every production route before the old app is unmapped",
+						"-verify-header":        "response header the app names the answering instance in, instead of asking the router for an instance of it",
+						"-verify-path":        "endpoint path to verify the production routes on, defaults to /",
+						"-verify-attempts":        "requests to send to a production route before giving up on the new app answering",
+						"-expect-version":        "git sha or build number every instance of the new app has to report before the routes are moved",
+						"-version-endpoint":        "endpoint path the new app reports its version on",
+						"-version-path":        "json path of the version in the body of the version endpoint, e.g. $.build.commit",
+						"-warmup-file":        "json list of requests or har file to replay against the new app before it gets the production routes",
+						"-warmup-concurrency":        "requests the warm-up sends at the same time",
+						"-warmup-duration":        "time in seconds to send warm-up requests for",
+						"-connect-timeout":        "time in seconds to connect to an app endpoint, defaults to 10",
+						"-read-timeout":        "time in seconds an app endpoint has to answer once connected, defaults to 30",
+						"-skip-ssl-validation":        "skip verification of the certificates of the app endpoints",
+						"-ca-cert":        "pem bundle of CA certificates to trust for the app endpoints on top of the system roots",
+						"-client-cert":        "pem client certificate to present to app endpoints that require mutual tls",
+						"-client-key":        "pem private key of the client certificate",
+						"-proxy":        "http proxy to reach the app endpoints through, defaults to the https_proxy environment variable",
+						"-scheme":        "https (default) or http, the scheme the app endpoints are requested with",
+						"-header":        "Name: value header to send to the app endpoints, env:NAME or file:path read the value. Can be repeated",
+						"-basic-auth":        "user:password to authenticate to the app endpoints with, or env:NAME or file:path to read it from",
+						"-bearer-token":        "bearer token to authenticate to the app endpoints with, or env:NAME or file:path to read it from",
+						"-cf-token":        "authenticate to the app endpoints with the oauth token of the cf cli",
+						"-probe-app":        "app to request the app endpoints from through cf ssh, for routes only reachable inside cloud foundry",
+						"-probe-instance":        "instance of the probe app to request the app endpoints from, defaults to 0",
+						"-probe-port":        "container port the probe app reaches the apps on over internal routes, defaults to 8080",
+						"-strategy":        "blue-green (default), canary, rolling or recreate",
+						"-maintenance-app":        "app that serves the production routes while the recreate strategy replaces the app",
+						"-start-timeout":        "time in seconds the instances of the new app have to start before the health test",
+						"-pre-switch-task":        "command to run as a task on the new app before the routes are moved to it, e.g. a migration",
+						"-task-timeout":        "time in seconds the pre-switch task has to finish",
+						"-logs-dir":        "directory to save the logs of a failed deployment to instead of printing them",
+						"-pre-hook":        "step=command to run before a step of the deployment, can be repeated",
+						"-post-hook":        "step=command to run after a step of the deployment, can be repeated",
+					},
+				},
+			},
+			{
+				Name: "safe-scale-rollback",
+				HelpText: "Moves the routes back to the last retired version of your application",
+				UsageDetails: plugin.Usage{
+					Usage: "safe-scale-rollback\n	cf safe-scale-rollback app_name [--trans] [--test] [--timeout] [--probe-domain] [--start-timeout] [--bake] [--retain] [--logs-dir] [--pre-hook] [--post-hook]",
+					Options: map[string]string{
+						"-trans":        "endpoint to monitor transactions",
+						"-test":        "endpoint to test if the retired version is healthy",
+						"-timeout":        "time in seconds to monitor transactions",
+						"-probe-domain":        "domain the health and transaction endpoints are reached on",
+						"-start-timeout":        "time in seconds the instances of the retired version have to start before the health test",
+						"-bake":        "time in seconds to watch the restored version on the production routes before draining",
+						"-retain":        "number of retired versions to keep, -1 keeps all of them",
+						"-logs-dir":        "directory to save the logs of a failed rollback to instead of printing them",
+						"-pre-hook":        "step=command to run before a step of the rollback, can be repeated",
+						"-post-hook":        "step=command to run after a step of the rollback, can be repeated",
+					},
+				},
+			},
+			{
+				Name: "safe-scale-gc",
+				HelpText: "Deletes the temp routes and stopped apps left behind by safe-scale",
+				UsageDetails: plugin.Usage{
+					Usage: "safe-scale-gc\n	cf safe-scale-gc [-f] [--dry-run] [--older-than]",
+					Options: map[string]string{
+						"f":        "delete without asking for confirmation",
+						"-dry-run":        "only show what would be deleted",
+						"-older-than":        "minutes after which a new app that never went live is abandoned",
 					},
 				},
 			},
@@ -111,18 +384,183 @@ func (c *SafeScaler) getArgs(args []string) error {
 	if len(args) == 2 {
 		return errors.New("ERROR. Insufficient arguments. Did not specify a name for new app\n")
 	}
+	//a flag in place of the new app name is only allowed when the new app takes over the original name
+	//or the app is replaced in place
+	flag_start := 3
+	if strings.HasPrefix(args[2], "-") {
+		flag_start = 2
+	}
+	//Do not want to parse through the command name and app name. Just focused on flags
+	if err := c.parseFlags(args[flag_start:]); err != nil {
+		return err
+	}
+	if flag_start == 2 && !c.rename && !c.inPlace() {
+		return errors.New("ERROR. Insufficient arguments. Did not specify a name for new app\n")
+	}
+	return nil
+}
+
+func (c *SafeScaler) parseFlags(args []string) error {
 	//creating flags and setting their default values
 	f := flag.NewFlagSet("f", flag.ContinueOnError)
 	inst_ptr := f.String("i", "1", "the number of instances for new app")
 	trans_ptr := f.String("trans", "", "endpoint path to monitor transactions")
 	test_ptr := f.String("test", "", "endpoint path to test new app deployed")
 	timeout_ptr := f.Int("timeout", 120, "time in seconds before transaction monitoring times out")
-	//Do not want to parse through the command name and app name. Just focused on flags
-	f.Parse(args[3:])
+	probe_domain_ptr := f.String("probe-domain", "", "domain the health and transaction endpoints are reached on")
+	route_suffix_ptr := f.String("route-suffix", "", "suffix for the temp and new app hostnames, {random} adds random characters")
+	reuse_routes_ptr := f.Bool("reuse-routes", false, "reuse temp routes left behind by a previous run")
+	rename_ptr := f.Bool("rename", false, "push the new app next to the original and give it the original name once it is live")
+	delete_old_ptr := f.Bool("delete-old", false, "with --rename, delete the old app instead of keeping it under a new name")
+	retain_ptr := f.Int("retain", -1, "number of retired versions to keep, -1 keeps all of them")
+	bake_ptr := f.Int("bake", 0, "time in seconds to watch the health of the new app on the production routes before draining the old app")
+	canary_steps_ptr := f.Int("canary-steps", 0, "number of stages to shift instances from the old app to the new app in")
+	canary_hold_ptr := f.Int("canary-hold", 60, "time in seconds to hold each canary stage while checks run")
+	strategy_ptr := f.String("strategy", strategy_blue_green, "how the app is replaced: blue-green, canary, rolling or recreate")
+	maintenance_ptr := f.String("maintenance-app", "", "app that serves the production routes while the recreate strategy replaces the app")
+	weights_ptr := f.String("weights", "", "comma separated percentages of traffic to shift to the new app with route weights, e.g. 5,25,50,100")
+	start_timeout_ptr := f.Int("start-timeout", 300, "time in seconds the instances of the new app have to start")
+	pre_switch_task_ptr := f.String("pre-switch-task", "", "command to run as a task on the new app before the routes are moved to it")
+	task_timeout_ptr := f.Int("task-timeout", 600, "time in seconds the pre-switch task has to finish")
+	error_margin_ptr := f.Float64("error-margin", -1, "percentage points the 5xx rate of the new app may exceed the old app's by before unmapping, -1 turns the check off")
+	latency_margin_ptr := f.Int("latency-margin", -1, "milliseconds the p99 latency of the new app may exceed the old app's by before unmapping, -1 turns the check off")
+	metrics := MetricChecks{}
+	f.Var(&metrics, "metric", "query:margin the new app's metric may exceed the old app's by during the bake, can be repeated")
+	metrics_path_ptr := f.String("metrics-path", "/metrics", "endpoint path the apps serve prometheus metrics on")
+	probe_rate_ptr := f.Float64("probe-rate", 0, "requests a second to send to every production route while the routes are switched")
+	probe_path_ptr := f.String("probe-path", "/", "endpoint path to probe the production routes on")
+	probe_fail_ptr := f.Bool("probe-fail", false, "fail the deployment when a probe of the production routes failed")
+	verify_routes_ptr := f.Bool("verify-routes", false, "make sure the new app answers on every production route before the old app is unmapped")
+	verify_header_ptr := f.String("verify-header", "", "response header the app names the answering instance in")
+	verify_path_ptr := f.String("verify-path", "/", "endpoint path to verify the production routes on")
+	verify_attempts_ptr := f.Int("verify-attempts", 20, "requests to send to a production route before giving up on the new app answering")
+	expect_version_ptr := f.String("expect-version", "", "git sha or build number every instance of the new app has to report before mapping")
+	version_endpoint_ptr := f.String("version-endpoint", "", "endpoint path the new app reports its version on")
+	version_path_ptr := f.String("version-path", "", "json path of the version in the body of the version endpoint")
+	warmup_file_ptr := f.String("warmup-file", "", "json list of requests or har file to replay against the new app before mapping")
+	warmup_concurrency_ptr := f.Int("warmup-concurrency", 4, "requests the warm-up sends at the same time")
+	warmup_duration_ptr := f.Int("warmup-duration", 30, "time in seconds to send warm-up requests for")
+	connect_timeout_ptr := f.Int("connect-timeout", 10, "time in seconds to connect to an app endpoint")
+	read_timeout_ptr := f.Int("read-timeout", 30, "time in seconds an app endpoint has to answer once connected")
+	skip_ssl_validation_ptr := f.Bool("skip-ssl-validation", false, "skip verification of the certificates of the app endpoints")
+	ca_cert_ptr := f.String("ca-cert", "", "pem bundle of CA certificates to trust for the app endpoints")
+	client_cert_ptr := f.String("client-cert", "", "pem client certificate for app endpoints that require mutual tls")
+	client_key_ptr := f.String("client-key", "", "pem private key of the client certificate")
+	proxy_ptr := f.String("proxy", "", "http proxy to reach the app endpoints through")
+	scheme_ptr := f.String("scheme", "https", "https or http, the scheme the app endpoints are requested with")
+	headers := Headers{}
+	f.Var(&headers, "header", "Name: value header to send to the app endpoints, can be repeated")
+	basic_auth_ptr := f.String("basic-auth", "", "user:password to authenticate to the app endpoints with, or env:NAME or file:path")
+	bearer_token_ptr := f.String("bearer-token", "", "bearer token to authenticate to the app endpoints with, or env:NAME or file:path")
+	cf_token_ptr := f.Bool("cf-token", false, "authenticate to the app endpoints with the oauth token of the cf cli")
+	probe_app_ptr := f.String("probe-app", "", "app to request the app endpoints from through cf ssh")
+	probe_instance_ptr := f.Int("probe-instance", 0, "instance of the probe app to request the app endpoints from")
+	probe_port_ptr := f.Int("probe-port", 8080, "container port the probe app reaches the apps on over internal routes")
+	logs_dir_ptr := f.String("logs-dir", "", "directory to save the logs of failed deployments to instead of printing them")
+	pre_hooks := Hooks{}
+	f.Var(pre_hooks, "pre-hook", "step=command to run before a step, can be repeated")
+	post_hooks := Hooks{}
+	f.Var(post_hooks, "post-hook", "step=command to run after a step, can be repeated")
+	if err := f.Parse(args); err != nil {
+		return errors.New("ERROR. " + err.Error() + "\n")
+	}
 	c.inst = *inst_ptr
 	c.test = *test_ptr
 	c.trans = *trans_ptr
 	c.timeout = *timeout_ptr
+	c.probe_domain = *probe_domain_ptr
+	c.route_suffix = *route_suffix_ptr
+	c.reuse_routes = *reuse_routes_ptr
+	c.rename = *rename_ptr
+	c.delete_old = *delete_old_ptr
+	c.retain = *retain_ptr
+	c.bake = *bake_ptr
+	c.canary_steps = *canary_steps_ptr
+	c.canary_hold = *canary_hold_ptr
+	c.strategy = *strategy_ptr
+	c.maintenance = *maintenance_ptr
+	c.start_timeout = *start_timeout_ptr
+	c.pre_switch_task = *pre_switch_task_ptr
+	c.task_timeout = *task_timeout_ptr
+	c.error_margin = *error_margin_ptr
+	c.latency_margin = *latency_margin_ptr
+	c.metrics = metrics
+	c.metrics_path = *metrics_path_ptr
+	c.probe_rate = *probe_rate_ptr
+	c.probe_path = *probe_path_ptr
+	c.probe_fail = *probe_fail_ptr
+	c.verify_routes = *verify_routes_ptr
+	c.verify_header = *verify_header_ptr
+	c.verify_path = *verify_path_ptr
+	c.verify_attempts = *verify_attempts_ptr
+	c.expect_version = *expect_version_ptr
+	c.version_endpoint = *version_endpoint_ptr
+	c.version_path = *version_path_ptr
+	c.warmup_file = *warmup_file_ptr
+	c.warmup_concurrency = *warmup_concurrency_ptr
+	c.warmup_duration = *warmup_duration_ptr
+	c.connect_timeout = *connect_timeout_ptr
+	c.read_timeout = *read_timeout_ptr
+	c.skip_ssl_validation = *skip_ssl_validation_ptr
+	c.ca_cert = *ca_cert_ptr
+	c.client_cert = *client_cert_ptr
+	c.client_key = *client_key_ptr
+	c.proxy = *proxy_ptr
+	c.scheme = *scheme_ptr
+	c.headers = headers
+	c.basic_auth = *basic_auth_ptr
+	c.bearer_token = *bearer_token_ptr
+	c.cf_token = *cf_token_ptr
+	c.probe_app = *probe_app_ptr
+	c.probe_instance = *probe_instance_ptr
+	c.probe_port = *probe_port_ptr
+	c.logs_dir = *logs_dir_ptr
+	c.pre_hooks = pre_hooks
+	c.post_hooks = post_hooks
+	weights, err := parseWeights(*weights_ptr)
+	if err != nil {
+		return err
+	}
+	c.weights = weights
+	if len(c.metrics) > 0 && c.bake <= 0 {
+		return errors.New("ERROR. --metric needs a --bake window to compare the apps in\n")
+	}
+	//without a canary the analysis runs seconds after mapping, before the router logged anything to compare
+	canary := c.strategy == strategy_canary || c.canary_steps > 0 || len(c.weights) > 0
+	if (c.error_margin >= 0 || c.latency_margin >= 0) && (!canary || c.canary_hold <= 0) {
+		return errors.New("ERROR. --error-margin and --latency-margin need a canary holding its stages for --canary-hold seconds to compare the apps in\n")
+	}
+	if c.expect_version != "" && c.version_endpoint == "" {
+		return errors.New("ERROR. --expect-version needs a --version-endpoint to read the version from\n")
+	}
+	if c.warmup_file != "" && c.warmup_concurrency < 1 {
+		return errors.New("ERROR. --warmup-concurrency needs to be at least 1\n")
+	}
+	if c.scheme != "https" && c.scheme != "http" {
+		return errors.New("ERROR. --scheme needs to be https or http\n")
+	}
+	if (c.client_cert == "") != (c.client_key == "") {
+		return errors.New("ERROR. --client-cert and --client-key need to be given together\n")
+	}
+	authentications := 0
+	for _, val := range []bool{c.basic_auth != "", c.bearer_token != "", c.cf_token} {
+		if val {
+			authentications++
+		}
+	}
+	if authentications > 1 {
+		return errors.New("ERROR. Only one of --basic-auth, --bearer-token and --cf-token can be given\n")
+	}
+	//also rejects NaN
+	if !(c.probe_rate >= 0 && c.probe_rate <= max_probe_rate) {
+		return errors.New("ERROR. --probe-rate needs to be between 0 and " + fmt.Sprint(max_probe_rate) + "\n")
+	}
+	if c.trans != "" && c.strategy == strategy_rolling {
+		return errors.New("ERROR. --trans can't be used with --strategy rolling. cf replaces the instances without waiting for their transactions\n")
+	}
+	if c.probe_instance < 0 {
+		return errors.New("ERROR. --probe-instance needs to be 0 or more\n")
+	}
 	return nil
 }
 
@@ -139,11 +577,15 @@ func (c *SafeScaler) getApp(cliConnection plugin.CliConnection, args []string) e
 		alive:        true,
 	}
 	properties.name = app.Name
+	properties.guid = app.Guid
+	properties.instances = app.InstanceCount
 	//getting routes from app
 	for _, value := range app.Routes {
 		new_route := Route{
 			domain:        value.Domain.Name,
 			host:        value.Host,
+			path:        value.Path,
+			port:        value.Port,
 		}
 		properties.routes = append(properties.routes, new_route)
 	}
@@ -155,8 +597,14 @@ func (c *SafeScaler) getApp(cliConnection plugin.CliConnection, args []string) e
 		return err
 	}
 	c.blue = properties
-	c.blue_routes = c.blue.routes
-	c.green = &AppProp{name:args[2], routes: []Route{}, alive: false}
+	//copy so removing routes from blue doesn't shift the production routes underneath us
+	c.blue_routes = append([]Route{}, c.blue.routes...)
+	//in-place strategies push the new code onto the old app
+	if c.inPlace() {
+		c.green = c.blue
+		return nil
+	}
+	c.green = &AppProp{name:c.greenName(args), routes: []Route{}, alive: false}
 	return nil
 }
 
@@ -166,31 +614,94 @@ func (c *SafeScaler) getSpace(cliConnection plugin.CliConnection) error {
 		return errors.New("ERROR. Could not find space in Cloud Foundry\n")
 	}
 	c.space = space.Name
+	c.space_guid = space.Guid
 	return nil
 }
 
 func (c *SafeScaler) createNewApp(cliConnection plugin.CliConnection) error {
+	if err := c.pushNewApp(cliConnection); err != nil {
+		return err
+	}
+	return c.bindServices(cliConnection)
+}
+
+func (c *SafeScaler) pushNewApp(cliConnection plugin.CliConnection) error {
 	if len(c.blue.routes) == 0 {
 		return errors.New("ERROR. Can't do blue green deployment because " + c.blue.name + " has no routes\n")
 	}
-	if err := c.pushApp(cliConnection); err != nil {
-		return err
+	if _, found := c.httpRoute(); !found {
+		if c.probe_domain != "" {
+			return errors.New("ERROR. Can't do blue green deployment because " + c.blue.name + " has no http routes on " + c.probe_domain + "\n")
+		}
+		return errors.New("ERROR. Can't do blue green deployment because " + c.blue.name + " has no http routes\n")
 	}
+	return c.pushApp(cliConnection)
+}
+
+func (c *SafeScaler) bindServices(cliConnection plugin.CliConnection) error {
 	//need to bind all the services of blue app to the green app
 	for _, val := range c.services {
 		if err := c.bindService(cliConnection, val); err != nil {
 			return err
 		}
 	}
+	c.labelApp(cliConnection, c.blue, role_blue)
+	c.labelApp(cliConnection, c.green, role_green)
+	c.labelRoute(cliConnection, c.green.routes[0], role_green)
 	return nil
 }
 
+//first http route of the old app on the probe domain. tcp routes can't carry the hostnames used for the new app and temp route
+func (c *SafeScaler) httpRoute() (Route, bool) {
+	for _, value := range c.blue.routes {
+		if value.port == 0 && (c.probe_domain == "" || value.domain == c.probe_domain) {
+			return value, true
+		}
+	}
+	return Route{}, false
+}
+
+//first http route of the old app on each of its domains
+func (c *SafeScaler) domainRoutes() []Route {
+	domain_routes := []Route{}
+	seen := map[string]bool{}
+	for _, value := range c.blue_routes {
+		if value.port != 0 || seen[value.domain] {
+			continue
+		}
+		seen[value.domain] = true
+		domain_routes = append(domain_routes, value)
+	}
+	return domain_routes
+}
+
+//route the endpoints are probed through. prefers the probe domain and falls back to the first route
+func (c *SafeScaler) probeRoute(routes []Route) Route {
+	for _, value := range routes {
+		if value.domain == c.probe_domain {
+			return value
+		}
+	}
+	return routes[0]
+}
+
 func (c *SafeScaler) pushApp(cliConnection plugin.CliConnection) error {
-	domain := c.blue.routes[0].domain
-	if _, err := cliConnection.CliCommand("push", c.green.name, "-i", c.inst, "--hostname", c.green.name, "-d", domain); err != nil {
+	base, _ := c.httpRoute()
+	domain := base.domain
+	//the new app's name may already be a hostname someone else holds on the domain
+	host, _, err := c.availableHost(cliConnection, c.green.name, domain)
+	if err != nil {
+		return err
+	}
+	//a canary starts out with a single instance. weighted canaries split traffic by weight instead
+	inst := c.inst
+	if c.canary_steps > 0 && len(c.weights) == 0 {
+		inst = "1"
+	}
+	if _, err := cliConnection.CliCommand("push", c.green.name, "-i", inst, "--hostname", host, "-d", domain); err != nil {
 		return errors.New("ERROR. Unable to push " + c.green.name + " to Cloud Foundry\n")
 	}
-	c.green.routes = append(c.green.routes, Route{host: c.green.name, domain: domain})
+	c.green.routes = append(c.green.routes, Route{host: host, domain: domain})
 	c.green.alive = true
 	return nil
 
@@ -203,63 +714,110 @@ func (c *SafeScaler) bindService(cliConnection plugin.CliConnection, val string)
 	return nil
 }
 
+func (c *SafeScaler) checkHealth(cliConnection plugin.CliConnection) error {
+	if err := c.awaitInstances(cliConnection, c.green); err != nil {
+		return err
+	}
+	if healthy := c.healthTest(c.client); !healthy {
+		return errors.New("ERROR. new app is not healthy. Can not continue blue-green deployment. Routes from old app will not be transferred to new app\n")
+	}
+	return nil
+}
+
 func (c *SafeScaler) healthTest(client *http.Client) bool {
 	//no endpoint so just continue with deployment
 	if c.test == "" {
 		return true
 	}
 	fmt.Println("Testing the health of the new app")
-	endpoint := "https://" + c.green.routes[0].host + "." + c.green.routes[0].domain + c.test
+	endpoint := c.url(c.probeRoute(c.green.routes), c.test)
+	return c.healthy(client, endpoint)
+}
+
+func (c *SafeScaler) healthy(client *http.Client, endpoint string) bool {
 	result, err := client.Get(endpoint) //test endpoint
 	//not ok or error so test failed 300 multiple things going on
-	if result.StatusCode != 200 || err != nil {
+	if err != nil {
 		return false
 	}
-	return true
+	result.Body.Close()
+	return result.StatusCode == 200
 }
 
 func (c *SafeScaler) mapping(cliConnection plugin.CliConnection) error {
-	//creates a temp route for old app
-	temp_route, err := c.createRoute(cliConnection)
-	if err != nil {
-		return err
-	}
-	//add temp route to old app
-	if err = c.addMap(cliConnection, c.blue, temp_route); err != nil {
-		return err
+	//the router logs of both apps are compared from here on
+	c.mapped = time.Now()
+	//creates a temp route for old app on every domain so it can drain on all of them
+	for _, base := range c.domainRoutes() {
+		temp_route, err := c.createRoute(cliConnection, base)
+		if err != nil {
+			return err
+		}
+		c.temp_routes = append(c.temp_routes, temp_route)
+		//add temp route to old app
+		if err = c.addMap(cliConnection, c.blue, temp_route); err != nil {
+			return err
+		}
 	}
-	//add all routes from old app to new app
+	//add all routes from old app to new app. weighted canaries add them with their first weight instead
 	for _, val := range c.blue_routes {
-		if err = c.addMap(cliConnection, c.green, val); err != nil {
+		if len(c.weights) > 0 {
+			break
+		}
+		if err := c.addMap(cliConnection, c.green, val); err != nil {
 			return err
 		}
 	}
+	for _, val := range c.temp_routes {
+		c.labelRoute(cliConnection, val, role_temp)
+	}
+	for _, val := range c.blue_routes {
+		c.labelRoute(cliConnection, val, role_live)
+	}
 	return nil
 }
 
-func (c *SafeScaler) createRoute(cliConnection plugin.CliConnection) (Route, error) {
+func (c *SafeScaler) createRoute(cliConnection plugin.CliConnection, base Route) (Route, error) {
+	//apex routes on private domains have no host to prefix so fall back on the app name
+	host := base.host
+	if host == "" {
+		host = c.blue.name
+	}
+	host, reused, err := c.availableHost(cliConnection, temp_prefix + host, base.domain)
+	if err != nil {
+		return Route{}, err
+	}
+	//temp route has no path so the monitoring endpoints resolve from the root of the app
 	temp_route := Route{
-		domain: c.blue.routes[0].domain,
-		host: "temp-" + c.blue.routes[0].host,
+		domain: base.domain,
+		host: host,
+	}
+	if reused {
+		return temp_route, nil
 	}
-	if _, err := cliConnection.CliCommand("create-route", c.space, temp_route.domain, "--hostname", temp_route.host);
-	err != nil {
-		return temp_route, errors.New("ERROR. Could not create a temporary route " + temp_route.domain + "." + temp_route.host + "\n")
+	args := append([]string{"create-route", c.space, temp_route.domain}, temp_route.flags()...)
+	if _, err := cliConnection.CliCommand(args...); err != nil {
+		return temp_route, errors.New("ERROR. Could not create a temporary route " + temp_route.name() + "\n")
 	}
 	return temp_route, nil
 }
 
 func (c *SafeScaler) addMap(cliConnection plugin.CliConnection, app *AppProp, route Route) error {
-	if _, err := cliConnection.CliCommand("map-route", app.name, route.domain, "--hostname", route.host); err != nil {
-		return errors.New("ERROR. Could not map " + route.domain + "." + route.host + " route to " + app.name + "\n")
+	args := append([]string{"map-route", app.name, route.domain}, route.flags()...)
+	if _, err := cliConnection.CliCommand(args...); err != nil {
+		return errors.New("ERROR. Could not map " + route.name() + " route to " + app.name + "\n")
 	}
 	app.routes = append(app.routes, route)
 	return nil
 }
 
 func (c *SafeScaler) unmapping(cliConnection plugin.CliConnection) error {
-	//unmap all routes from blue with exception of temp route for monitoring purposes
+	//unmap all routes from blue with exception of temp route for monitoring purposes.
+	//a weighted canary already took blue off the routes when it shifted all traffic to green
 	for _, val := range c.blue_routes {
+		if !c.blue.hasRoute(val) {
+			continue
+		}
 		if err := c.removeMap(cliConnection, c.blue, val, false); err != nil {
 			return err
 		}
@@ -273,18 +831,11 @@ func (c *SafeScaler) unmapping(cliConnection plugin.CliConnection) error {
 }
 
 func (c *SafeScaler) removeMap(cliConnection plugin.CliConnection, app *AppProp, route Route, orphan bool) error {
-	if _, err := cliConnection.CliCommand("unmap-route", app.name, route.domain, "--hostname", route.host);
-	err != nil {
-		return errors.New("ERROR. Could not unmap " + route.domain + "." + route.host + " route from " + app.name + "\n")
-	}
-	//updating app routes array
-	for i, value := range app.routes {
-		if value.host == route.host && value.domain == route.domain {
-			new_routes := append(app.routes[:i], app.routes[i + 1:]...)
-			app.routes = new_routes
-			break
-		}
+	args := append([]string{"unmap-route", app.name, route.domain}, route.flags()...)
+	if _, err := cliConnection.CliCommand(args...); err != nil {
+		return errors.New("ERROR. Could not unmap " + route.name() + " route from " + app.name + "\n")
 	}
+	app.dropRoute(route)
 	if orphan == true {
 		if err := c.deleteRoute(cliConnection, route); err != nil {
 			return err
@@ -294,8 +845,9 @@ func (c *SafeScaler) removeMap(cliConnection plugin.CliConnection, app *AppProp,
 }
 
 func (c *SafeScaler) deleteRoute(cliConnection plugin.CliConnection, route Route) error {
-	if _, err := cliConnection.CliCommand("delete-route", route.domain, "--hostname", route.host, "-f"); err != nil {
-		return errors.New("ERROR. Could not delete " + route.domain + "." + route.host + " route from space\n")
+	args := append(append([]string{"delete-route", route.domain}, route.flags()...), "-f")
+	if _, err := cliConnection.CliCommand(args...); err != nil {
+		return errors.New("ERROR. Could not delete " + route.name() + " route from space\n")
 	}
 	return nil
 }
@@ -306,7 +858,7 @@ func (c *SafeScaler) monitorTransactions(client *http.Client) error {
 		return nil
 	}
 	fmt.Println("Checking trans endpoint...")
-	trans_endpoint := "https://" + c.blue.routes[0].host + "." + c.blue.routes[0].domain + c.trans
+	trans_endpoint := c.url(c.probeRoute(c.blue.routes), c.trans)
 	base := time.Now() //baseline time to measure against
 	current := time.Since(base).Seconds()
 	//loop to continuously monitor transactions until it times out
@@ -323,20 +875,25 @@ func (c *SafeScaler) monitorTransactions(client *http.Client) error {
 		if result.StatusCode != 200 {
 			return errors.New("ERROR. Status code " + strconv.Itoa(result.StatusCode) + ". " + trans_endpoint + " endpoint is not okay. Check to make sure " + c.blue.name + " is healthy\n")
 		}
-		time.Sleep(3 * time.Second)
+		time.Sleep(poll_interval)
 		current = time.Since(base).Seconds()
 	}
 	return errors.New("ERROR. The request timed out. " + trans_endpoint + " endpoint failed to provide HTTP Status Code 204. Can't safely shut down " + c.blue.name + "\n")
 }
 
 func (c *SafeScaler) powerDown(cliConnection plugin.CliConnection) error {
-	if err := c.removeMap(cliConnection, c.blue, c.blue.routes[0], true); err != nil {
-		return err
+	//only the temp routes are left on the old app at this point
+	for _, val := range append([]Route{}, c.blue.routes...) {
+		if err := c.removeMap(cliConnection, c.blue, val, true); err != nil {
+			return err
+		}
 	}
 	if _, err := cliConnection.CliCommand("stop", c.blue.name); err != nil {
 		return errors.New("ERROR. Failed to stop " + c.blue.name + " from running\n")
 	}
 	c.blue.alive = false
+	c.labelApp(cliConnection, c.blue, role_retired)
+	c.labelApp(cliConnection, c.green, role_live)
 	return nil
 }
 
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -11,3 +14,12 @@ func TestSafeScale(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "SafeScale Suite")
 }
+
+//cf commands the plugin ran on the fake connection, in order
+func cliCommands(connection *pluginfakes.FakeCliConnection) []string {
+	commands := []string{}
+	for i := 0; i < connection.CliCommandCallCount(); i++ {
+		commands = append(commands, strings.Join(connection.CliCommandArgsForCall(i), " "))
+	}
+	return commands
+}
@@ -114,6 +114,27 @@ var _ = Describe("safescale", func() {
 			Expect(ExamplePlugin.blue.routes).To(Equal([]Route{
 				{host: "foo", domain: "cfapps.io"}, {host: "bar", domain: "cfapps.io"}}))
 		})
+		It("keeps the path and port of routes", func() {
+			domain_name := plugin_models.GetApp_DomainFields{Name: "cfapps.io"}
+			tcp_domain := plugin_models.GetApp_DomainFields{Name: "tcp.cfapps.io"}
+			route := []plugin_models.GetApp_RouteSummary{
+				{
+					Host:        "foo",
+					Domain:        domain_name,
+					Path:        "/api",
+				},
+				{
+					Domain:        tcp_domain,
+					Port:        1024,
+				},
+			}
+			app := plugin_models.GetAppModel{Routes: route}
+			connection.GetAppReturns(app, nil)
+			err := ExamplePlugin.getApp(connection, []string{"safe-scale", "", ""})
+			Expect(err).To(BeNil())
+			Expect(ExamplePlugin.blue.routes).To(Equal([]Route{
+				{host: "foo", domain: "cfapps.io", path: "/api"}, {domain: "tcp.cfapps.io", port: 1024}}))
+		})
 		It("has no services", func() {
 			app := plugin_models.GetAppModel{}
 			connection.GetAppReturns(app, nil)
@@ -161,6 +182,19 @@ var _ = Describe("safescale", func() {
 			Expect(err.Error()).To(Equal("ERROR. Can't do blue green deployment because foo has no routes\n"))
 
 		})
+		It("should fail to create new app if the blue app only has tcp routes", func() {
+			ExamplePlugin.blue = &AppProp{routes: []Route{{domain: "tcp.cfapps.io", port: 1024}}, name: "foo"}
+			err := ExamplePlugin.createNewApp(connection)
+			Expect(err.Error()).To(Equal("ERROR. Can't do blue green deployment because foo has no http routes\n"))
+		})
+		It("should push the new app on the domain of the first http route", func() {
+			ExamplePlugin.blue = &AppProp{routes: []Route{{domain: "tcp.cfapps.io", port: 1024}, {domain: "cfapps.io"}}}
+			ExamplePlugin.inst = "1"
+			connection.CliCommandReturns([]string{"yes"}, nil)
+			err := ExamplePlugin.pushApp(connection)
+			Expect(err).To(BeNil())
+			Expect(connection.CliCommandArgsForCall(0)).To(Equal([]string{"push", "new-app", "-i", "1", "--hostname", "new-app", "-d", "cfapps.io"}))
+		})
 		It("should push a new app sucesfully", func() {
 			connection.CliCommandReturns([]string{"yes"}, nil)
 			err := ExamplePlugin.pushApp(connection)
@@ -198,6 +232,14 @@ var _ = Describe("safescale", func() {
 			result := ExamplePlugin.healthTest(client)
 			Expect(result).To(BeTrue())
 		})
+		It("should test the health through a hostless route with a path", func() {
+			ExamplePlugin.green = &AppProp{routes: []Route{{domain: "private.io", path: "/api"}}}
+			maker := fakepoint.NewFakepointMaker()
+			maker.NewGet("https://private.io/api/test", 200)
+			client := maker.Client()
+			result := ExamplePlugin.healthTest(client)
+			Expect(result).To(BeTrue())
+		})
 		It("should return false if the app is not healthy", func() {
 			maker := fakepoint.NewFakepointMaker()
 			maker.NewGet("https://foo.cfapps.io/test", 400)
@@ -223,6 +265,40 @@ var _ = Describe("safescale", func() {
 			Expect(ExamplePlugin.green.routes).To(Equal([]Route{{host: "temp", domain: "cfapps.io"},
 				{host: "moved", domain: "cfapps.io"}}))
 		})
+		It("should map a route with a path", func() {
+			connection.CliCommandReturns([]string{"it worked"}, nil)
+			moved := Route{host: "moved", domain: "cfapps.io", path: "/api"}
+			err := ExamplePlugin.addMap(connection, ExamplePlugin.green, moved)
+			Expect(err).To(BeNil())
+			Expect(connection.CliCommandArgsForCall(0)).To(Equal([]string{"map-route", "green-app", "cfapps.io", "--hostname", "moved", "--path", "/api"}))
+		})
+		It("should map a tcp route without a hostname", func() {
+			connection.CliCommandReturns([]string{"it worked"}, nil)
+			moved := Route{domain: "tcp.cfapps.io", port: 1024}
+			err := ExamplePlugin.addMap(connection, ExamplePlugin.green, moved)
+			Expect(err).To(BeNil())
+			Expect(connection.CliCommandArgsForCall(0)).To(Equal([]string{"map-route", "green-app", "tcp.cfapps.io", "--port", "1024"}))
+		})
+		It("should create a temp route for a hostless route", func() {
+			ExamplePlugin.blue = &AppProp{name: "blue-app", routes: []Route{{domain: "private.io", path: "/api"}}}
+			ExamplePlugin.space = "sandbox"
+			connection.CliCommandReturns([]string{"it worked"}, nil)
+			temp_route, err := ExamplePlugin.createRoute(connection, ExamplePlugin.blue.routes[0])
+			Expect(err).To(BeNil())
+			Expect(temp_route).To(Equal(Route{host: "temp-blue-app", domain: "private.io"}))
+			Expect(connection.CliCommandArgsForCall(0)).To(Equal([]string{"create-route", "sandbox", "private.io", "--hostname", "temp-blue-app"}))
+		})
+		It("should create a temp route on every domain of the old app", func() {
+			ExamplePlugin.blue = &AppProp{name: "blue-app", routes: []Route{}}
+			ExamplePlugin.blue_routes = []Route{{host: "foo", domain: "cfapps.io"}, {host: "bar", domain: "cfapps.io"},
+				{host: "foo", domain: "apps.internal"}, {domain: "tcp.cfapps.io", port: 1024}}
+			connection.CliCommandReturns([]string{"it worked"}, nil)
+			err := ExamplePlugin.mapping(connection)
+			Expect(err).To(BeNil())
+			Expect(ExamplePlugin.temp_routes).To(Equal([]Route{{host: "temp-foo", domain: "cfapps.io"},
+				{host: "temp-foo", domain: "apps.internal"}}))
+			Expect(ExamplePlugin.blue.routes).To(Equal(ExamplePlugin.temp_routes))
+		})
 		It("should fail if it can't add map", func() {
 			connection.CliCommandReturns(nil, errors.New("could not map route"))
 			bad_route := Route{domain: "fake", host: "cfapps.io"}
@@ -273,6 +349,20 @@ var _ = Describe("safescale", func() {
 			err := ExamplePlugin.deleteRoute(connection, orphan_route)
 			Expect(err).To(BeNil())
 		})
+		It("should only unmap the route with the matching path", func() {
+			result.routes = []Route{{host: "foo", domain: "cfapps.io"}, {host: "foo", domain: "cfapps.io", path: "/api"}}
+			connection.CliCommandReturns([]string{"it worked"}, nil)
+			err := ExamplePlugin.removeMap(connection, result, Route{host: "foo", domain: "cfapps.io", path: "/api"}, false)
+			Expect(err).To(BeNil())
+			Expect(result.routes).To(Equal([]Route{{host: "foo", domain: "cfapps.io"}}))
+			Expect(connection.CliCommandArgsForCall(0)).To(Equal([]string{"unmap-route", "foo", "cfapps.io", "--hostname", "foo", "--path", "/api"}))
+		})
+		It("should delete a hostless route", func() {
+			connection.CliCommandReturns([]string{"it worked"}, nil)
+			err := ExamplePlugin.deleteRoute(connection, Route{domain: "private.io"})
+			Expect(err).To(BeNil())
+			Expect(connection.CliCommandArgsForCall(0)).To(Equal([]string{"delete-route", "private.io", "-f"}))
+		})
 		It("should fail if it can't delete an orphaned route", func() {
 			orphan_route := Route{domain: "bad", host: "route"}
 			connection.CliCommandReturns(nil, errors.New("It could not delete route"))
@@ -311,6 +401,34 @@ var _ = Describe("safescale", func() {
 		})
 	})
 
+	Describe("probe domain", func() {
+		It("should push the new app on the probe domain", func() {
+			ExamplePlugin.blue = &AppProp{routes: []Route{{host: "foo", domain: "cfapps.io"}, {host: "foo", domain: "apps.internal"}}}
+			ExamplePlugin.green = &AppProp{name: "new-app", routes: []Route{}}
+			ExamplePlugin.probe_domain = "apps.internal"
+			connection.CliCommandReturns([]string{"yes"}, nil)
+			err := ExamplePlugin.pushApp(connection)
+			Expect(err).To(BeNil())
+			Expect(ExamplePlugin.green.routes).To(Equal([]Route{{host: "new-app", domain: "apps.internal"}}))
+		})
+		It("should fail if the old app has no routes on the probe domain", func() {
+			ExamplePlugin.blue = &AppProp{name: "foo", routes: []Route{{host: "foo", domain: "cfapps.io"}}}
+			ExamplePlugin.probe_domain = "apps.internal"
+			err := ExamplePlugin.createNewApp(connection)
+			Expect(err.Error()).To(Equal("ERROR. Can't do blue green deployment because foo has no http routes on apps.internal\n"))
+		})
+		It("should monitor transactions through the temp route on the probe domain", func() {
+			ExamplePlugin.blue = &AppProp{name: "foo", routes: []Route{{host: "temp-foo", domain: "cfapps.io"}, {host: "temp-foo", domain: "apps.internal"}}}
+			ExamplePlugin.probe_domain = "apps.internal"
+			ExamplePlugin.trans = "/trans"
+			ExamplePlugin.timeout = 4
+			maker := fakepoint.NewFakepointMaker()
+			maker.NewGet("https://temp-foo.apps.internal/trans", 204)
+			result := ExamplePlugin.monitorTransactions(maker.Client())
+			Expect(result).To(BeNil())
+		})
+	})
+
 	Describe("power down", func() {
 		BeforeEach(func() {
 			ExamplePlugin.blue = &AppProp{alive: true, routes: []Route{{domain: "cfapps.io", host: "foo"}}}
@@ -321,6 +439,15 @@ var _ = Describe("safescale", func() {
 			Expect(err).To(BeNil())
 			Expect(ExamplePlugin.blue.alive).To(BeFalse())
 		})
+		It("should delete the temp route on every domain", func() {
+			ExamplePlugin.blue.name = "foo"
+			ExamplePlugin.blue.routes = []Route{{domain: "cfapps.io", host: "temp-foo"}, {domain: "apps.internal", host: "temp-foo"}}
+			connection.CliCommandReturns([]string{"sucess"}, nil)
+			err := ExamplePlugin.powerDown(connection)
+			Expect(err).To(BeNil())
+			Expect(ExamplePlugin.blue.routes).To(Equal([]Route{}))
+			Expect(connection.CliCommandArgsForCall(3)).To(Equal([]string{"delete-route", "apps.internal", "--hostname", "temp-foo", "-f"}))
+		})
 	})
 
 })
\ No newline at end of file
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//one series of a prometheus text format scrape
+type sample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+//value of a query over the bake window, computed from the scrape at its start and the one at its end
+type Query func(start []sample, end []sample) float64
+
+//query of --metric and the margin the new app's value may exceed the old app's by
+type MetricCheck struct {
+	expr   string
+	query  Query
+	margin float64
+}
+
+//every --metric flag adds a check
+type MetricChecks []MetricCheck
+
+func (m *MetricChecks) String() string {
+	checks := []string{}
+	for _, val := range *m {
+		checks = append(checks, val.expr+":"+strconv.FormatFloat(val.margin, 'f', -1, 64))
+	}
+	return strings.Join(checks, ", ")
+}
+
+//takes query:margin. the margin goes after the last colon as metric names may hold colons themselves
+func (m *MetricChecks) Set(value string) error {
+	i := strings.LastIndex(value, ":")
+	if i < 0 {
+		return errors.New("metric checks take the form query:margin")
+	}
+	margin, err := strconv.ParseFloat(strings.TrimSpace(value[i+1:]), 64)
+	if err != nil {
+		return errors.New("metric checks take the form query:margin")
+	}
+	expr := strings.TrimSpace(value[:i])
+	query, err := parseQuery(expr)
+	if err != nil {
+		return err
+	}
+	*m = append(*m, MetricCheck{expr: expr, query: query, margin: margin})
+	return nil
+}
+
+//scrapes of both apps at the start of the bake
+type Baseline struct {
+	blue  []sample
+	green []sample
+}
+
+//scrapes the old app on its temp route and the new app on the production routes
+func (c *SafeScaler) scrapeApps(cliConnection plugin.CliConnection, client *http.Client) (Baseline, error) {
+	blue, err := c.scrapeInstances(cliConnection, client, c.blue, c.probeRoute(c.temp_routes))
+	if err != nil {
+		return Baseline{}, err
+	}
+	green, err := c.scrapeInstances(cliConnection, client, c.green, c.probeRoute(c.green.routes))
+	if err != nil {
+		return Baseline{}, err
+	}
+	return Baseline{blue: blue, green: green}, nil
+}
+
+//adds up the series of every instance of the app. a scrape through the router reaches any instance, and the
+//counters of one instance can't be compared to those of another, so each one is asked for with the
+//X-Cf-App-Instance request header
+func (c *SafeScaler) scrapeInstances(cliConnection plugin.CliConnection, client *http.Client, app *AppProp, route Route) ([]sample, error) {
+	model, err := cliConnection.GetApp(app.name)
+	if err != nil {
+		return nil, errors.New("ERROR. Could not access " + app.name + " in Cloud Foundry\n")
+	}
+	instances := model.InstanceCount
+	if instances < 1 {
+		instances = 1
+	}
+	endpoint := c.url(route, c.metrics_path)
+	totals := []sample{}
+	series := map[string]int{}
+	for i := 0; i < instances; i++ {
+		samples, err := scrape(client, endpoint, model.Guid+":"+strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		for _, val := range samples {
+			key := seriesKey(val)
+			if j, found := series[key]; found {
+				totals[j].value += val.value
+				continue
+			}
+			series[key] = len(totals)
+			totals = append(totals, val)
+		}
+	}
+	return totals, nil
+}
+
+//name and sorted labels of a series
+func seriesKey(series sample) string {
+	labels := []string{}
+	for key, value := range series.labels {
+		labels = append(labels, key+"="+strconv.Quote(value))
+	}
+	sort.Strings(labels)
+	return series.name + "{" + strings.Join(labels, ",") + "}"
+}
+
+func scrape(client *http.Client, endpoint string, instance string) ([]sample, error) {
+	request, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, errors.New("ERROR. Could not scrape " + endpoint + "\n")
+	}
+	request.Header.Set(instance_header, instance)
+	result, err := client.Do(request)
+	if err != nil {
+		return nil, errors.New("ERROR. Could not scrape " + endpoint + " of instance " + instance + "\n")
+	}
+	defer result.Body.Close()
+	if result.StatusCode != 200 {
+		return nil, errors.New("ERROR. Status code " + strconv.Itoa(result.StatusCode) + " scraping " + endpoint + " of instance " + instance + "\n")
+	}
+	samples, err := parseMetrics(result.Body)
+	if err != nil {
+		return nil, errors.New("ERROR. " + endpoint + " is not in prometheus text format. " + err.Error() + "\n")
+	}
+	return samples, nil
+}
+
+//compares the queries over the bake window. the routes go back to the old app when the new app does worse than
+//the margin allows
+func (c *SafeScaler) compareMetrics(cliConnection plugin.CliConnection, client *http.Client, baseline Baseline) error {
+	if len(c.metrics) == 0 {
+		return nil
+	}
+	current, err := c.scrapeApps(cliConnection, client)
+	if err != nil {
+		return c.abort(cliConnection, err.Error())
+	}
+	for _, val := range c.metrics {
+		blue := val.query(baseline.blue, current.blue)
+		green := val.query(baseline.green, current.green)
+		fmt.Printf("%s: %s %g, %s %g\n", val.expr, c.green.name, green, c.blue.name, blue)
+		if green-blue > val.margin {
+			return c.abort(cliConnection, fmt.Sprintf("ERROR. %s of %s is %g against %g for %s, more than the margin of %g\n", val.expr, c.green.name, green, blue, c.blue.name, val.margin))
+		}
+	}
+	return nil
+}
+
+func parseMetrics(body io.Reader) ([]sample, error) {
+	samples := []sample{}
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		selector, rest, err := splitSeries(line)
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return nil, errors.New("no value for " + selector.name)
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, errors.New("invalid value for " + selector.name)
+		}
+		labels := map[string]string{}
+		for _, val := range selector.matchers {
+			labels[val.label] = val.value
+		}
+		samples = append(samples, sample{name: selector.name, labels: labels, value: value})
+	}
+	return samples, scanner.Err()
+}
+
+//label matcher of a selector. =~ matches the whole value against a regular expression
+type matcher struct {
+	label string
+	value string
+	regex *regexp.Regexp
+}
+
+type selector struct {
+	name     string
+	matchers []matcher
+}
+
+var metric_name = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*`)
+
+//splits name{labels} off the front of a series or selector
+func splitSeries(text string) (selector, string, error) {
+	text = strings.TrimSpace(text)
+	name := metric_name.FindString(text)
+	if name == "" {
+		return selector{}, "", errors.New("no metric name in " + text)
+	}
+	sel := selector{name: name, matchers: []matcher{}}
+	rest := text[len(name):]
+	if !strings.HasPrefix(rest, "{") {
+		return sel, rest, nil
+	}
+	rest = rest[1:]
+	for {
+		rest = strings.TrimLeft(rest, " ,")
+		if strings.HasPrefix(rest, "}") {
+			return sel, rest[1:], nil
+		}
+		label := metric_name.FindString(rest)
+		if label == "" {
+			return selector{}, "", errors.New("invalid labels for " + name)
+		}
+		rest = strings.TrimLeft(rest[len(label):], " ")
+		regex := strings.HasPrefix(rest, "=~")
+		if regex {
+			rest = rest[2:]
+		} else if strings.HasPrefix(rest, "=") {
+			rest = rest[1:]
+		} else {
+			return selector{}, "", errors.New("invalid labels for " + name)
+		}
+		value, remaining, err := unquote(strings.TrimLeft(rest, " "))
+		if err != nil {
+			return selector{}, "", errors.New("invalid labels for " + name)
+		}
+		rest = remaining
+		match := matcher{label: label, value: value}
+		if regex {
+			if match.regex, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+				return selector{}, "", err
+			}
+		}
+		sel.matchers = append(sel.matchers, match)
+	}
+}
+
+//reads a double quoted label value off the front of the text
+func unquote(text string) (string, string, error) {
+	if !strings.HasPrefix(text, `"`) {
+		return "", "", errors.New("label value is not quoted")
+	}
+	value := ""
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if i+1 < len(text) {
+				i++
+				if text[i] == 'n' {
+					value += "\n"
+				} else {
+					value += string(text[i])
+				}
+			}
+		case '"':
+			return value, text[i+1:], nil
+		default:
+			value += string(text[i])
+		}
+	}
+	return "", "", errors.New("label value is not closed")
+}
+
+func parseSelector(text string) (selector, error) {
+	sel, rest, err := splitSeries(text)
+	if err != nil {
+		return sel, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return sel, errors.New("unexpected " + rest + " after " + sel.name)
+	}
+	return sel, nil
+}
+
+func (s selector) matches(val sample) bool {
+	if val.name != s.name {
+		return false
+	}
+	for _, m := range s.matchers {
+		if m.regex != nil {
+			if !m.regex.MatchString(val.labels[m.label]) {
+				return false
+			}
+		} else if val.labels[m.label] != m.value {
+			return false
+		}
+	}
+	return true
+}
+
+func (s selector) sum(samples []sample) float64 {
+	total := 0.0
+	for _, val := range samples {
+		if s.matches(val) {
+			total += val.value
+		}
+	}
+	return total
+}
+
+//queries are a selector, which gives the summed value at the end of the window, increase(selector) for how much a
+//counter grew over the window, ratio(selector, selector) for the increase of one counter over another's, e.g. an
+//error ratio, or quantile(q, histogram) for a quantile of the observations over the window, e.g. p95 latency
+func parseQuery(expr string) (Query, error) {
+	expr = strings.TrimSpace(expr)
+	open := strings.Index(expr, "(")
+	if open < 0 || !strings.HasSuffix(expr, ")") || strings.ContainsAny(expr[:open], "{\"") {
+		sel, err := parseSelector(expr)
+		if err != nil {
+			return nil, err
+		}
+		return func(start []sample, end []sample) float64 {
+			return sel.sum(end)
+		}, nil
+	}
+	function := strings.TrimSpace(expr[:open])
+	args := splitArgs(expr[open+1 : len(expr)-1])
+	switch {
+	case function == "increase" && len(args) == 1:
+		sel, err := parseSelector(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return func(start []sample, end []sample) float64 {
+			return sel.sum(end) - sel.sum(start)
+		}, nil
+	case function == "ratio" && len(args) == 2:
+		numerator, err := parseSelector(args[0])
+		if err != nil {
+			return nil, err
+		}
+		denominator, err := parseSelector(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return func(start []sample, end []sample) float64 {
+			total := denominator.sum(end) - denominator.sum(start)
+			if total <= 0 {
+				return 0
+			}
+			return (numerator.sum(end) - numerator.sum(start)) / total
+		}, nil
+	case function == "quantile" && len(args) == 2:
+		q, err := strconv.ParseFloat(strings.TrimSpace(args[0]), 64)
+		if err != nil || q < 0 || q > 1 {
+			return nil, errors.New("quantile takes a number between 0 and 1, not " + args[0])
+		}
+		sel, err := parseSelector(args[1])
+		if err != nil {
+			return nil, err
+		}
+		sel.name += "_bucket"
+		return func(start []sample, end []sample) float64 {
+			return histogramQuantile(q, sel, start, end)
+		}, nil
+	}
+	return nil, errors.New("unknown query " + expr + ". Use a selector, increase, ratio or quantile")
+}
+
+//splits function arguments on the commas outside of braces and quotes
+func splitArgs(text string) []string {
+	args := []string{}
+	depth, quoted, begin := 0, false, 0
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && quoted:
+			i++
+		case text[i] == '"':
+			quoted = !quoted
+		case quoted:
+		case text[i] == '{':
+			depth++
+		case text[i] == '}':
+			depth--
+		case text[i] == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(text[begin:i]))
+			begin = i + 1
+		}
+	}
+	return append(args, strings.TrimSpace(text[begin:]))
+}
+
+//quantile of the observations a histogram made over the window, interpolated within the bucket it falls in the
+//way prometheus does
+func histogramQuantile(q float64, buckets selector, start []sample, end []sample) float64 {
+	counts := map[float64]float64{}
+	for _, window := range []struct {
+		samples []sample
+		sign    float64
+	}{{end, 1}, {start, -1}} {
+		for _, val := range window.samples {
+			if !buckets.matches(val) {
+				continue
+			}
+			bound, err := strconv.ParseFloat(val.labels["le"], 64)
+			if err != nil {
+				continue
+			}
+			counts[bound] += window.sign * val.value
+		}
+	}
+	bounds := []float64{}
+	for bound := range counts {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+	if len(bounds) == 0 || counts[bounds[len(bounds)-1]] <= 0 {
+		return 0
+	}
+	rank := q * counts[bounds[len(bounds)-1]]
+	lower, below := 0.0, 0.0
+	for _, bound := range bounds {
+		if counts[bound] >= rank {
+			if math.IsInf(bound, 1) {
+				return lower
+			}
+			if counts[bound] == below {
+				return bound
+			}
+			return lower + (bound-lower)*(rank-below)/(counts[bound]-below)
+		}
+		lower, below = bound, counts[bound]
+	}
+	return lower
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/cloudfoundry/cli/plugin/models"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const blue_metrics = `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{code="200",path="/api"} 1000
+http_requests_total{code="500",path="/api"} 10
+# HELP http_request_duration_seconds Request latency.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="0.05"} 800
+http_request_duration_seconds_bucket{le="0.1"} 950
+http_request_duration_seconds_bucket{le="0.5"} 1005
+http_request_duration_seconds_bucket{le="+Inf"} 1010
+http_request_duration_seconds_sum 40.5
+http_request_duration_seconds_count 1010
+process_open_fds 12
+`
+
+var _ = Describe("metrics", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		server        *httptest.Server
+		mutex         sync.Mutex
+		bodies        map[string][]string
+		client        *http.Client
+		instances     map[string]int
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.CliCommandReturns([]string{"OK"}, nil)
+		instances = map[string]int{"shop-v1": 1, "shop-v2": 1}
+		connection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+			return plugin_models.GetAppModel{Name: name, Guid: name + "-guid", InstanceCount: instances[name]}, nil
+		}
+		bodies = map[string][]string{}
+		//serves the next scrape of the host and instance it is asked for
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			key := r.Host + " " + r.Header.Get("X-Cf-App-Instance")
+			if r.URL.Path != "/metrics" || len(bodies[key]) == 0 {
+				w.WriteHeader(404)
+				return
+			}
+			w.Write([]byte(bodies[key][0]))
+			bodies[key] = bodies[key][1:]
+		}))
+		client = &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+				return net.Dial(network, server.Listener.Addr().String())
+			},
+		}}
+		prod := Route{host: "shop", domain: "cfapps.io"}
+		temp := Route{host: "temp-shop", domain: "cfapps.io"}
+		ExamplePlugin = &SafeScaler{
+			blue:         &AppProp{name: "shop-v1", routes: []Route{temp}, alive: true},
+			green:        &AppProp{name: "shop-v2", routes: []Route{prod}, alive: true},
+			blue_routes:  []Route{prod},
+			temp_routes:  []Route{temp},
+			metrics_path: "/metrics",
+		}
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	Describe("parsing", func() {
+		It("should read the series of the text format", func() {
+			samples, err := parseMetrics(strings.NewReader(blue_metrics))
+			Expect(err).To(BeNil())
+			Expect(samples).To(HaveLen(9))
+			Expect(samples[1]).To(Equal(sample{name: "http_requests_total", labels: map[string]string{"code": "500", "path": "/api"}, value: 10}))
+			Expect(samples[8]).To(Equal(sample{name: "process_open_fds", labels: map[string]string{}, value: 12}))
+		})
+		It("should read escaped label values and timestamps", func() {
+			samples, err := parseMetrics(strings.NewReader(`msgdrain_errors_total{reason="say \"hi\"\n", app="a,b"} 3 1729339200000`))
+			Expect(err).To(BeNil())
+			Expect(samples[0].labels).To(Equal(map[string]string{"reason": "say \"hi\"\n", "app": "a,b"}))
+			Expect(samples[0].value).To(Equal(3.0))
+		})
+		It("should reject what isn't the text format", func() {
+			_, err := parseMetrics(strings.NewReader("<html>Not found</html>"))
+			Expect(err).NotTo(BeNil())
+		})
+	})
+	Describe("queries", func() {
+		var start, end []sample
+		BeforeEach(func() {
+			start, _ = parseMetrics(strings.NewReader(blue_metrics))
+			end, _ = parseMetrics(strings.NewReader(strings.NewReplacer(
+				`code="200",path="/api"} 1000`, `code="200",path="/api"} 1190`,
+				`code="500",path="/api"} 10`, `code="500",path="/api"} 20`,
+				`le="0.05"} 800`, `le="0.05"} 900`,
+				`le="0.1"} 950`, `le="0.1"} 1130`,
+				`le="0.5"} 1005`, `le="0.5"} 1200`,
+				`le="+Inf"} 1010`, `le="+Inf"} 1210`,
+			).Replace(blue_metrics)))
+		})
+		It("should compute the error ratio over the window", func() {
+			query, err := parseQuery(`ratio(http_requests_total{code=~"5.."}, http_requests_total)`)
+			Expect(err).To(BeNil())
+			Expect(query(start, end)).To(Equal(0.05))
+		})
+		It("should compute the increase of a counter", func() {
+			query, err := parseQuery(`increase(http_requests_total{path="/api", code="200"})`)
+			Expect(err).To(BeNil())
+			Expect(query(start, end)).To(Equal(190.0))
+		})
+		It("should compute histogram quantiles over the window", func() {
+			query, err := parseQuery(`quantile(0.95, http_request_duration_seconds)`)
+			Expect(err).To(BeNil())
+			//p95 is the 190th of the 200 observations of the window, the 10th of the 15 between 0.1 and 0.5
+			Expect(query(start, end)).To(BeNumerically("~", 0.1+0.4*10/15, 0.0001))
+			query, _ = parseQuery(`quantile(0.5, http_request_duration_seconds)`)
+			Expect(query(start, end)).To(BeNumerically("~", 0.05, 0.0001))
+		})
+		It("should read gauges at the end of the window", func() {
+			query, err := parseQuery(`process_open_fds`)
+			Expect(err).To(BeNil())
+			Expect(query(start, end)).To(Equal(12.0))
+		})
+		It("should reject unknown queries", func() {
+			_, err := parseQuery(`rate(http_requests_total)`)
+			Expect(err.Error()).To(Equal("unknown query rate(http_requests_total). Use a selector, increase, ratio or quantile"))
+		})
+	})
+	Describe("flags", func() {
+		It("should take the margin after the last colon", func() {
+			err := ExamplePlugin.parseFlags([]string{"--bake", "60", "--metric", `ratio(job:errors:total, job:requests:total):0.01`})
+			Expect(err).To(BeNil())
+			Expect(ExamplePlugin.metrics).To(HaveLen(1))
+			Expect(ExamplePlugin.metrics[0].expr).To(Equal("ratio(job:errors:total, job:requests:total)"))
+			Expect(ExamplePlugin.metrics[0].margin).To(Equal(0.01))
+		})
+		It("should need a bake window", func() {
+			err := ExamplePlugin.parseFlags([]string{"--metric", "process_open_fds:10"})
+			Expect(err.Error()).To(Equal("ERROR. --metric needs a --bake window to compare the apps in\n"))
+		})
+	})
+	Describe("comparing", func() {
+		BeforeEach(func() {
+			ExamplePlugin.metrics = MetricChecks{}
+			ExamplePlugin.metrics.Set(`ratio(http_requests_total{code=~"5.."}, http_requests_total):0.01`)
+			bodies["temp-shop.cfapps.io shop-v1-guid:0"] = []string{blue_metrics, strings.Replace(blue_metrics, `code="200",path="/api"} 1000`, `code="200",path="/api"} 1990`, 1)}
+		})
+		It("should pass when the new app is within the margin", func() {
+			bodies["shop.cfapps.io shop-v2-guid:0"] = []string{blue_metrics, strings.Replace(blue_metrics, `code="200",path="/api"} 1000`, `code="200",path="/api"} 1500`, 1)}
+			baseline, err := ExamplePlugin.scrapeApps(connection, client)
+			Expect(err).To(BeNil())
+			err = ExamplePlugin.compareMetrics(connection, client, baseline)
+			Expect(err).To(BeNil())
+			Expect(connection.CliCommandCallCount()).To(Equal(0))
+		})
+		It("should move the routes back when the new app does worse", func() {
+			bodies["shop.cfapps.io shop-v2-guid:0"] = []string{blue_metrics, strings.Replace(blue_metrics, `code="500",path="/api"} 10`, `code="500",path="/api"} 30`, 1)}
+			baseline, err := ExamplePlugin.scrapeApps(connection, client)
+			Expect(err).To(BeNil())
+			err = ExamplePlugin.compareMetrics(connection, client, baseline)
+			Expect(err.Error()).To(Equal(`ERROR. ratio(http_requests_total{code=~"5.."}, http_requests_total) of shop-v2 is 1 against 0 for shop-v1, more than the margin of 0.01` + "\n" +
+				"ERROR. Deployment was aborted. Production routes are served by shop-v1\n"))
+			Expect(strings.Join(connection.CliCommandArgsForCall(0), " ")).To(Equal("map-route shop-v1 cfapps.io --hostname shop"))
+		})
+		It("should compare the counters of each instance with themselves", func() {
+			instances["shop-v2"] = 2
+			busy := strings.NewReplacer(`code="200",path="/api"} 1000`, `code="200",path="/api"} 9000`, `code="500",path="/api"} 10`, `code="500",path="/api"} 90`)
+			bodies["shop.cfapps.io shop-v2-guid:0"] = []string{blue_metrics, strings.Replace(blue_metrics, `code="200",path="/api"} 1000`, `code="200",path="/api"} 1500`, 1)}
+			bodies["shop.cfapps.io shop-v2-guid:1"] = []string{busy.Replace(blue_metrics), strings.Replace(busy.Replace(blue_metrics), `code="200",path="/api"} 9000`, `code="200",path="/api"} 9500`, 1)}
+			baseline, err := ExamplePlugin.scrapeApps(connection, client)
+			Expect(err).To(BeNil())
+			Expect(baseline.green[0]).To(Equal(sample{name: "http_requests_total", labels: map[string]string{"code": "200", "path": "/api"}, value: 10000}))
+			err = ExamplePlugin.compareMetrics(connection, client, baseline)
+			Expect(err).To(BeNil())
+			Expect(bodies["shop.cfapps.io shop-v2-guid:1"]).To(BeEmpty())
+		})
+		It("should catch errors of a single instance", func() {
+			instances["shop-v2"] = 2
+			bodies["shop.cfapps.io shop-v2-guid:0"] = []string{blue_metrics, strings.Replace(blue_metrics, `code="200",path="/api"} 1000`, `code="200",path="/api"} 1500`, 1)}
+			bodies["shop.cfapps.io shop-v2-guid:1"] = []string{blue_metrics, strings.Replace(blue_metrics, `code="500",path="/api"} 10`, `code="500",path="/api"} 60`, 1)}
+			baseline, err := ExamplePlugin.scrapeApps(connection, client)
+			Expect(err).To(BeNil())
+			err = ExamplePlugin.compareMetrics(connection, client, baseline)
+			Expect(err.Error()).To(HavePrefix(`ERROR. ratio(http_requests_total{code=~"5.."}, http_requests_total) of shop-v2 is 0.09090909090909091 against 0 for shop-v1`))
+		})
+		It("should fail safe when an app can't be scraped", func() {
+			_, err := ExamplePlugin.scrapeApps(connection, client)
+			Expect(err.Error()).To(Equal("ERROR. Status code 404 scraping https://shop.cfapps.io/metrics of instance shop-v2-guid:0\n"))
+		})
+	})
+})
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//prefix of the temporary routes the plugin creates for the old app
+const temp_prefix = "temp-"
+
+//attempts at finding a free hostname before giving up
+const host_attempts = 5
+
+//suffix added to the hostnames of the temp and new app routes. {random} is replaced with random characters
+func (c *SafeScaler) hostSuffix() string {
+	return strings.Replace(c.route_suffix, "{random}", randomString(), -1)
+}
+
+//picks a hostname on the domain that isn't taken. a taken temp route is reused when --reuse-routes is set
+//and the plugin left it behind in a previous run
+func (c *SafeScaler) availableHost(cliConnection plugin.CliConnection, host string, domain string) (string, bool, error) {
+	candidate := host + c.hostSuffix()
+	for attempt := 0; attempt < host_attempts; attempt++ {
+		exists, err := c.routeExists(cliConnection, Route{host: candidate, domain: domain})
+		if err != nil {
+			return "", false, err
+		}
+		if !exists {
+			return candidate, false, nil
+		}
+		if c.reuse_routes && strings.HasPrefix(candidate, temp_prefix) && c.leftBehind(cliConnection, Route{host: candidate, domain: domain}) {
+			fmt.Println("Reusing " + domain + "." + candidate + " route from a previous run")
+			return candidate, true, nil
+		}
+		candidate = host + c.hostSuffix() + "-" + randomString()
+	}
+	return "", false, errors.New("ERROR. Could not find a free hostname for " + host + " on " + domain + "\n")
+}
+
+func (c *SafeScaler) routeExists(cliConnection plugin.CliConnection, route Route) (bool, error) {
+	output, err := cliConnection.CliCommandWithoutTerminalOutput("check-route", route.host, route.domain)
+	if err != nil {
+		return false, errors.New("ERROR. Could not check if " + route.name() + " route exists\n")
+	}
+	//cf prints "Route ... does exist" or "Route ... does not exist"
+	return strings.Contains(strings.Join(output, "\n"), "does exist"), nil
+}
+
+//the route carries the temp label of the plugin and no app is mapped to it any more. a temp-* route someone else
+//created, or one another deployment still uses, is never taken over
+func (c *SafeScaler) leftBehind(cliConnection plugin.CliConnection, route Route) bool {
+	guid, err := c.routeGuid(cliConnection, route)
+	if err != nil {
+		return false
+	}
+	resource := labelledResource{}
+	if err := c.curl(cliConnection, &resource, "/v3/routes/"+guid); err != nil || resource.Metadata.Labels[label_prefix+"role"] != role_temp {
+		return false
+	}
+	destinations := destinationList{}
+	if err := c.curl(cliConnection, &destinations, "/v3/routes/"+guid+"/destinations"); err != nil {
+		return false
+	}
+	return len(destinations.Destinations) == 0
+}
+
+func randomString() string {
+	bytes := make([]byte, 3)
+	if _, err := rand.Read(bytes); err != nil {
+		return "0"
+	}
+	return hex.EncodeToString(bytes)
+}
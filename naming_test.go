@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("naming", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		taken         map[string]bool
+		route         string
+		destinations  string
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		ExamplePlugin = &SafeScaler{}
+		taken = map[string]bool{}
+		route = `{"guid": "route-guid", "metadata": {"labels": {"safe-scale/role": "temp"}}}`
+		destinations = `{"destinations": []}`
+		connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			switch {
+			case args[0] != "curl":
+			case strings.HasPrefix(args[1], "/v3/domains"):
+				return []string{`{"resources": [{"guid": "domain-guid"}]}`}, nil
+			case strings.HasPrefix(args[1], "/v3/routes?"):
+				return []string{`{"resources": [{"guid": "route-guid", "host": "temp-foo"}]}`}, nil
+			case args[1] == "/v3/routes/route-guid":
+				return []string{route}, nil
+			case args[1] == "/v3/routes/route-guid/destinations":
+				return []string{destinations}, nil
+			}
+			if taken[args[1]] {
+				return []string{"Route " + args[1] + "." + args[2] + " does exist"}, nil
+			}
+			return []string{"Route " + args[1] + "." + args[2] + " does not exist"}, nil
+		}
+	})
+	It("should keep the hostname when it is free", func() {
+		host, reused, err := ExamplePlugin.availableHost(connection, "temp-foo", "cfapps.io")
+		Expect(err).To(BeNil())
+		Expect(host).To(Equal("temp-foo"))
+		Expect(reused).To(BeFalse())
+		Expect(connection.CliCommandWithoutTerminalOutputArgsForCall(0)).To(Equal([]string{"check-route", "temp-foo", "cfapps.io"}))
+	})
+	It("should add the templated suffix", func() {
+		ExamplePlugin.route_suffix = "-{random}"
+		host, _, err := ExamplePlugin.availableHost(connection, "temp-foo", "cfapps.io")
+		Expect(err).To(BeNil())
+		Expect(host).To(HavePrefix("temp-foo-"))
+		Expect(len(host)).To(Equal(len("temp-foo-") + 6))
+	})
+	It("should pick another hostname when the route is taken", func() {
+		taken["new-app"] = true
+		host, reused, err := ExamplePlugin.availableHost(connection, "new-app", "cfapps.io")
+		Expect(err).To(BeNil())
+		Expect(host).To(HavePrefix("new-app-"))
+		Expect(reused).To(BeFalse())
+	})
+	It("should reuse a temp route left behind by a previous run", func() {
+		taken["temp-foo"] = true
+		ExamplePlugin.reuse_routes = true
+		host, reused, err := ExamplePlugin.availableHost(connection, "temp-foo", "cfapps.io")
+		Expect(err).To(BeNil())
+		Expect(host).To(Equal("temp-foo"))
+		Expect(reused).To(BeTrue())
+	})
+	It("should not reuse a temp route the plugin didn't label", func() {
+		taken["temp-foo"] = true
+		ExamplePlugin.reuse_routes = true
+		route = `{"guid": "route-guid", "metadata": {"labels": {}}}`
+		host, reused, err := ExamplePlugin.availableHost(connection, "temp-foo", "cfapps.io")
+		Expect(err).To(BeNil())
+		Expect(host).To(HavePrefix("temp-foo-"))
+		Expect(reused).To(BeFalse())
+	})
+	It("should not reuse a temp route an app is still mapped to", func() {
+		taken["temp-foo"] = true
+		ExamplePlugin.reuse_routes = true
+		destinations = `{"destinations": [{"app": {"guid": "other-guid"}}]}`
+		host, reused, err := ExamplePlugin.availableHost(connection, "temp-foo", "cfapps.io")
+		Expect(err).To(BeNil())
+		Expect(host).To(HavePrefix("temp-foo-"))
+		Expect(reused).To(BeFalse())
+	})
+	It("should not reuse a route the plugin didn't create", func() {
+		taken["new-app"] = true
+		ExamplePlugin.reuse_routes = true
+		_, reused, err := ExamplePlugin.availableHost(connection, "new-app", "cfapps.io")
+		Expect(err).To(BeNil())
+		Expect(reused).To(BeFalse())
+	})
+	It("should give up when every hostname is taken", func() {
+		connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			return []string{"Route does exist"}, nil
+		}
+		_, _, err := ExamplePlugin.availableHost(connection, "new-app", "cfapps.io")
+		Expect(err.Error()).To(Equal("ERROR. Could not find a free hostname for new-app on cfapps.io\n"))
+	})
+	It("should fail if it can't check the route", func() {
+		connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			return nil, errors.New("not logged in")
+		}
+		_, _, err := ExamplePlugin.availableHost(connection, "new-app", "cfapps.io")
+		Expect(err.Error()).To(Equal("ERROR. Could not check if cfapps.io.new-app route exists\n"))
+	})
+	It("should not create a reused temp route", func() {
+		taken["temp-foo"] = true
+		ExamplePlugin.reuse_routes = true
+		ExamplePlugin.blue = &AppProp{name: "foo"}
+		temp_route, err := ExamplePlugin.createRoute(connection, Route{host: "foo", domain: "cfapps.io"})
+		Expect(err).To(BeNil())
+		Expect(temp_route).To(Equal(Route{host: "temp-foo", domain: "cfapps.io"}))
+		Expect(connection.CliCommandCallCount()).To(Equal(0))
+	})
+	It("should push the new app on a free hostname", func() {
+		taken["new-app"] = true
+		ExamplePlugin.blue = &AppProp{routes: []Route{{host: "foo", domain: "cfapps.io"}}}
+		ExamplePlugin.green = &AppProp{name: "new-app", routes: []Route{}}
+		connection.CliCommandReturns([]string{"yes"}, nil)
+		err := ExamplePlugin.pushApp(connection)
+		Expect(err).To(BeNil())
+		Expect(strings.HasPrefix(ExamplePlugin.green.routes[0].host, "new-app-")).To(BeTrue())
+		Expect(connection.CliCommandArgsForCall(0)[5]).To(Equal(ExamplePlugin.green.routes[0].host))
+	})
+})
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//names of the steps a deployment is made of. hooks are attached to steps by these names
+const (
+	step_get_app    = "getApp"
+	step_start      = "start"
+	step_push       = "push"
+	step_bind       = "bind"
+	step_version    = "version"
+	step_task       = "task"
+	step_health     = "health"
+	step_warmup     = "warmup"
+	step_map        = "map"
+	step_canary     = "canary"
+	step_analysis   = "analysis"
+	step_verify     = "verify"
+	step_unmap      = "unmap"
+	step_bake       = "bake"
+	step_drain      = "drain"
+	step_power_down = "powerDown"
+	step_rename     = "rename"
+	step_prune      = "prune"
+	step_remap      = "remap"
+)
+
+type Step struct {
+	name string
+	run  func(cliConnection plugin.CliConnection) error
+}
+
+//shell commands to run around the steps, by step name. every --pre-hook or --post-hook flag adds one
+type Hooks map[string][]string
+
+func (h Hooks) String() string {
+	hooks := []string{}
+	for step, commands := range h {
+		for _, command := range commands {
+			hooks = append(hooks, step+"="+command)
+		}
+	}
+	sort.Strings(hooks)
+	return strings.Join(hooks, ", ")
+}
+
+func (h Hooks) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || strings.TrimSpace(parts[1]) == "" {
+		return errors.New("hooks take the form step=command")
+	}
+	h[parts[0]] = append(h[parts[0]], parts[1])
+	return nil
+}
+
+//runs the steps in order with their hooks. a failing hook or a crash of the new app aborts the deployment and
+//moves the routes back to the old app, a failing step returns its own error
+func (c *SafeScaler) runPipeline(cliConnection plugin.CliConnection, steps []Step) error {
+	names := []string{}
+	for _, step := range steps {
+		names = append(names, step.name)
+	}
+	for _, hooks := range []Hooks{c.pre_hooks, c.post_hooks} {
+		for step := range hooks {
+			if !contains(names, step) {
+				return errors.New("ERROR. There is no step named " + step + ". Steps are " + strings.Join(names, ", ") + "\n")
+			}
+		}
+	}
+	//deferred first so the policies go once nothing probes anymore
+	defer c.revokeProbes(cliConnection)
+	defer c.stopWatching()
+	defer c.stopProbing()
+	if c.started.IsZero() {
+		c.started = time.Now()
+	}
+	for _, step := range steps {
+		if err := c.allowProbes(cliConnection); err != nil {
+			return c.attachLogs(cliConnection, step.name, err)
+		}
+		if err := c.runHooks(cliConnection, "pre", step.name, c.pre_hooks[step.name]); err != nil {
+			return c.attachLogs(cliConnection, step.name, err)
+		}
+		if err := step.run(cliConnection); err != nil {
+			return c.attachLogs(cliConnection, step.name, err)
+		}
+		if err := c.checkCrashes(cliConnection); err != nil {
+			return c.attachLogs(cliConnection, step.name, err)
+		}
+		if err := c.runHooks(cliConnection, "post", step.name, c.post_hooks[step.name]); err != nil {
+			return c.attachLogs(cliConnection, step.name, err)
+		}
+	}
+	return nil
+}
+
+func (c *SafeScaler) runHooks(cliConnection plugin.CliConnection, kind string, step string, commands []string) error {
+	for _, command := range commands {
+		fmt.Println("Running " + kind + "-hook of " + step + ": " + command)
+		hook := exec.Command("sh", "-c", command)
+		hook.Env = append(os.Environ(), c.hookEnv(cliConnection, step)...)
+		hook.Stdout = os.Stdout
+		hook.Stderr = os.Stderr
+		if err := hook.Run(); err != nil {
+			return c.abort(cliConnection, "ERROR. The "+kind+"-hook of "+step+" failed: "+err.Error()+"\n")
+		}
+	}
+	return nil
+}
+
+//the old app is only known once getApp ran, before that there is nothing to roll back
+func (c *SafeScaler) abort(cliConnection plugin.CliConnection, cause string) error {
+	if c.blue == nil || c.green == nil {
+		return errors.New(cause + "ERROR. Deployment was aborted\n")
+	}
+	if err := c.restoreRoutes(cliConnection); err != nil {
+		return errors.New(cause + err.Error())
+	}
+	if c.replaced && c.standby != nil {
+		return errors.New(cause + "ERROR. Deployment was aborted. Production routes are served by " + c.standby.name + "\n")
+	}
+	if c.replaced && len(c.blue_routes) > 0 && !c.blue.hasRoute(c.blue_routes[0]) {
+		return errors.New(cause + "ERROR. Deployment was aborted. Production routes were left unmapped as " + c.blue.name + " runs the new code\n")
+	}
+	return errors.New(cause + "ERROR. Deployment was aborted. Production routes are served by " + c.blue.name + "\n")
+}
+
+//deployment context handed to the hooks. values that aren't known yet are left empty
+func (c *SafeScaler) hookEnv(cliConnection plugin.CliConnection, step string) []string {
+	env := map[string]string{
+		"SAFE_SCALE_STEP":        step,
+		"SAFE_SCALE_STRATEGY":    c.strategy,
+		"SAFE_SCALE_DEPLOYMENT":  c.deployment,
+		"SAFE_SCALE_SPACE":       c.space,
+		"SAFE_SCALE_SPACE_GUID":  c.space_guid,
+		"SAFE_SCALE_ROUTES":      addresses(c.blue_routes),
+		"SAFE_SCALE_TEMP_ROUTES": addresses(c.temp_routes),
+	}
+	if c.blue != nil {
+		env["SAFE_SCALE_OLD_APP"] = c.blue.name
+		env["SAFE_SCALE_OLD_APP_GUID"] = c.blue.guid
+	}
+	if c.green != nil {
+		env["SAFE_SCALE_NEW_APP"] = c.green.name
+		env["SAFE_SCALE_NEW_APP_ROUTES"] = addresses(c.green.routes)
+		//the new app only has a guid once it is pushed
+		if c.green.alive {
+			env["SAFE_SCALE_NEW_APP_GUID"], _ = c.appGuid(cliConnection, c.green)
+		}
+	}
+	list := []string{}
+	for key, value := range env {
+		list = append(list, key+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func addresses(routes []Route) string {
+	list := []string{}
+	for _, val := range routes {
+		list = append(list, val.address())
+	}
+	return strings.Join(list, " ")
+}
+
+func contains(list []string, value string) bool {
+	for _, val := range list {
+		if val == value {
+			return true
+		}
+	}
+	return false
+}
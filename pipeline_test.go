@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pipeline", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		ran           []string
+		step          func(name string) Step
+		dir           string
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.CliCommandReturns([]string{"OK"}, nil)
+		ExamplePlugin = &SafeScaler{pre_hooks: Hooks{}, post_hooks: Hooks{}}
+		ran = []string{}
+		step = func(name string) Step {
+			return Step{name, func(cliConnection plugin.CliConnection) error {
+				ran = append(ran, name)
+				return nil
+			}}
+		}
+		dir, _ = ioutil.TempDir("", "hooks")
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+	Describe("hook flags", func() {
+		It("should collect repeated hooks per step", func() {
+			err := ExamplePlugin.parseFlags([]string{"--pre-hook", "map=./migrate.sh", "--pre-hook", "map=echo a=b", "--post-hook", "drain=true"})
+			Expect(err).To(BeNil())
+			Expect(ExamplePlugin.pre_hooks).To(Equal(Hooks{"map": {"./migrate.sh", "echo a=b"}}))
+			Expect(ExamplePlugin.post_hooks).To(Equal(Hooks{"drain": {"true"}}))
+		})
+		It("should reject hooks without a step", func() {
+			err := ExamplePlugin.parseFlags([]string{"--pre-hook", "./migrate.sh"})
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("hooks take the form step=command"))
+		})
+	})
+	It("should run the steps in order", func() {
+		err := ExamplePlugin.runPipeline(connection, []Step{step("push"), step("map"), step("unmap")})
+		Expect(err).To(BeNil())
+		Expect(ran).To(Equal([]string{"push", "map", "unmap"}))
+	})
+	It("should stop at the first failing step", func() {
+		failing := Step{"map", func(cliConnection plugin.CliConnection) error {
+			return errors.New("ERROR. map failed\n")
+		}}
+		err := ExamplePlugin.runPipeline(connection, []Step{step("push"), failing, step("unmap")})
+		Expect(err.Error()).To(Equal("ERROR. map failed\n"))
+		Expect(ran).To(Equal([]string{"push"}))
+	})
+	It("should refuse hooks on steps the deployment doesn't have", func() {
+		ExamplePlugin.pre_hooks["migrate"] = []string{"true"}
+		err := ExamplePlugin.runPipeline(connection, []Step{step("push"), step("map")})
+		Expect(err.Error()).To(Equal("ERROR. There is no step named migrate. Steps are push, map\n"))
+		Expect(ran).To(BeEmpty())
+	})
+	It("should run the hooks around their step with the deployment context", func() {
+		out := filepath.Join(dir, "out")
+		ExamplePlugin.blue = &AppProp{name: "shop-v1", guid: "blue-guid", alive: true}
+		ExamplePlugin.green = &AppProp{name: "shop-v2", routes: []Route{{host: "shop-v2", domain: "cfapps.io"}}}
+		ExamplePlugin.blue_routes = []Route{{host: "shop", domain: "cfapps.io"}, {host: "shop", domain: "cfapps.io", path: "/api"}}
+		ExamplePlugin.deployment = "20261019-120000-abcdef"
+		ExamplePlugin.pre_hooks["map"] = []string{"echo pre $SAFE_SCALE_STEP $SAFE_SCALE_OLD_APP $SAFE_SCALE_OLD_APP_GUID >> " + out}
+		ExamplePlugin.post_hooks["map"] = []string{
+			"echo post $SAFE_SCALE_NEW_APP $SAFE_SCALE_NEW_APP_ROUTES >> " + out,
+			"echo $SAFE_SCALE_ROUTES $SAFE_SCALE_DEPLOYMENT >> " + out,
+		}
+		err := ExamplePlugin.runPipeline(connection, []Step{step("push"), step("map")})
+		Expect(err).To(BeNil())
+		content, _ := ioutil.ReadFile(out)
+		Expect(strings.Split(strings.TrimSpace(string(content)), "\n")).To(Equal([]string{
+			"pre map shop-v1 blue-guid",
+			"post shop-v2 shop-v2.cfapps.io",
+			"shop.cfapps.io shop.cfapps.io/api 20261019-120000-abcdef",
+		}))
+	})
+	It("should abort and move the routes back to the old app when a hook fails", func() {
+		prod := Route{host: "shop", domain: "cfapps.io"}
+		temp := Route{host: "temp-shop", domain: "cfapps.io"}
+		ExamplePlugin.blue = &AppProp{name: "shop-v1", routes: []Route{temp}, alive: true}
+		ExamplePlugin.green = &AppProp{name: "shop-v2", routes: []Route{prod}, alive: true}
+		ExamplePlugin.blue_routes = []Route{prod}
+		ExamplePlugin.temp_routes = []Route{temp}
+		ExamplePlugin.post_hooks["unmap"] = []string{"exit 3"}
+		err := ExamplePlugin.runPipeline(connection, []Step{step("unmap"), step("drain")})
+		Expect(err.Error()).To(Equal("ERROR. The post-hook of unmap failed: exit status 3\nERROR. Deployment was aborted. Production routes are served by shop-v1\n"))
+		Expect(ran).To(Equal([]string{"unmap"}))
+		commands := cliCommands(connection)
+		Expect(commands).To(Equal([]string{
+			"map-route shop-v1 cfapps.io --hostname shop",
+			"unmap-route shop-v2 cfapps.io --hostname shop",
+			"unmap-route shop-v1 cfapps.io --hostname temp-shop",
+			"delete-route cfapps.io --hostname temp-shop -f",
+		}))
+	})
+	It("should start the old app again when it was already powered down", func() {
+		prod := Route{host: "shop", domain: "cfapps.io"}
+		ExamplePlugin.blue = &AppProp{name: "shop-v1", routes: []Route{}, alive: false}
+		ExamplePlugin.green = &AppProp{name: "shop-v2", routes: []Route{prod}, alive: true}
+		ExamplePlugin.blue_routes = []Route{prod}
+		ExamplePlugin.post_hooks["powerDown"] = []string{"false"}
+		err := ExamplePlugin.runPipeline(connection, []Step{step("powerDown")})
+		Expect(err).NotTo(BeNil())
+		Expect(strings.Join(connection.CliCommandArgsForCall(0), " ")).To(Equal("start shop-v1"))
+		Expect(ExamplePlugin.blue.routes).To(Equal([]Route{prod}))
+		Expect(ExamplePlugin.green.routes).To(BeEmpty())
+	})
+	It("should not roll back before the old app is known", func() {
+		ExamplePlugin.pre_hooks["getApp"] = []string{"false"}
+		err := ExamplePlugin.runPipeline(connection, []Step{step("getApp")})
+		Expect(err.Error()).To(Equal("ERROR. The pre-hook of getApp failed: exit status 1\nERROR. Deployment was aborted\n"))
+		Expect(ran).To(BeEmpty())
+		Expect(connection.CliCommandCallCount()).To(Equal(0))
+	})
+})
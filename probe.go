@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+//most requests a second sent to a route. higher rates would round the ticker interval down to nothing
+const max_probe_rate = 1000
+
+//requests the production routes in the background while they are switched to record whether any were dropped
+type Prober struct {
+	stop    chan bool
+	done    sync.WaitGroup
+	mutex   sync.Mutex
+	routes  []Route
+	results map[Route]*AccessStats
+}
+
+//starts probing every http production route --probe-rate times a second
+func (c *SafeScaler) startProbing(client *http.Client) {
+	if c.probe_rate <= 0 {
+		return
+	}
+	c.stopProbing()
+	prober := &Prober{stop: make(chan bool), routes: []Route{}, results: map[Route]*AccessStats{}}
+	interval := time.Duration(float64(time.Second) / c.probe_rate)
+	for _, val := range c.blue_routes {
+		if val.port != 0 {
+			continue
+		}
+		prober.routes = append(prober.routes, val)
+		prober.results[val] = &AccessStats{statuses: map[string]int{}, latencies: []time.Duration{}}
+		prober.done.Add(1)
+		go prober.probe(client, val, c.url(val, c.probe_path), interval)
+	}
+	fmt.Printf("Probing %d production routes %g times a second\n", len(prober.routes), c.probe_rate)
+	c.prober = prober
+}
+
+func (p *Prober) probe(client *http.Client, route Route, endpoint string, interval time.Duration) {
+	defer p.done.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		base := time.Now()
+		result, err := client.Get(endpoint)
+		class := "error"
+		if err == nil {
+			result.Body.Close()
+			class = fmt.Sprint(result.StatusCode/100) + "xx"
+		}
+		p.mutex.Lock()
+		stats := p.results[route]
+		stats.requests++
+		stats.statuses[class]++
+		stats.latencies = append(stats.latencies, time.Since(base))
+		p.mutex.Unlock()
+	}
+}
+
+//requests that didn't get an answer or got a 5xx, which the router answers with when no app is behind the route
+func failedProbes(stats *AccessStats) int {
+	return stats.statuses["error"] + stats.statuses["5xx"]
+}
+
+//stops the prober and prints what every route answered. returns how many requests failed
+func (c *SafeScaler) stopProbing() int {
+	if c.prober == nil {
+		return 0
+	}
+	prober := c.prober
+	c.prober = nil
+	close(prober.stop)
+	prober.done.Wait()
+	failed := 0
+	fmt.Println("Production routes during the switch:")
+	for _, val := range prober.routes {
+		stats := prober.results[val]
+		sort.Slice(stats.latencies, func(i, j int) bool { return stats.latencies[i] < stats.latencies[j] })
+		failed += failedProbes(stats)
+		fmt.Printf("  %s: %d failed, %s\n", val.address(), failedProbes(stats), stats.String())
+	}
+	return failed
+}
+
+//ends the probe window once the old app is stopped. with --probe-fail a single failed request fails the deployment
+func (c *SafeScaler) finishProbing() error {
+	failed := c.stopProbing()
+	if failed > 0 && c.probe_fail {
+		return errors.New("ERROR. " + fmt.Sprint(failed) + " requests to the production routes failed while they were switched\n")
+	}
+	return nil
+}
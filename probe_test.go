@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("probe", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		server        *httptest.Server
+		mutex         sync.Mutex
+		status        int
+		setStatus     func(code int)
+		client        *http.Client
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.CliCommandReturns([]string{"OK"}, nil)
+		status = 200
+		setStatus = func(code int) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			status = code
+		}
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			w.WriteHeader(status)
+		}))
+		client = &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+				return net.Dial(network, server.Listener.Addr().String())
+			},
+		}}
+		ExamplePlugin = &SafeScaler{
+			blue_routes: []Route{{host: "shop", domain: "cfapps.io"}, {host: "shop", domain: "apps.internal"}, {domain: "tcp.cfapps.io", port: 1024}},
+			probe_rate:  200,
+			probe_path:  "/",
+		}
+	})
+	AfterEach(func() {
+		ExamplePlugin.stopProbing()
+		server.Close()
+	})
+	It("should do nothing without a rate", func() {
+		ExamplePlugin.probe_rate = 0
+		ExamplePlugin.startProbing(client)
+		Expect(ExamplePlugin.prober).To(BeNil())
+		Expect(ExamplePlugin.finishProbing()).To(BeNil())
+	})
+	It("should not take rates the ticker can't keep", func() {
+		for _, val := range []string{"1e12", "-1", "NaN", "Inf"} {
+			err := ExamplePlugin.parseFlags([]string{"--probe-rate", val})
+			Expect(err.Error()).To(Equal("ERROR. --probe-rate needs to be between 0 and 1000\n"))
+		}
+		Expect(ExamplePlugin.parseFlags([]string{"--probe-rate", "1000"})).To(BeNil())
+	})
+	It("should probe the http routes and count what they answered", func() {
+		ExamplePlugin.startProbing(client)
+		Expect(ExamplePlugin.prober.routes).To(Equal(ExamplePlugin.blue_routes[:2]))
+		time.Sleep(50 * time.Millisecond)
+		prober := ExamplePlugin.prober
+		Expect(ExamplePlugin.stopProbing()).To(Equal(0))
+		for _, val := range prober.routes {
+			Expect(prober.results[val].requests).To(BeNumerically(">", 0))
+			Expect(prober.results[val].statuses["2xx"]).To(Equal(prober.results[val].requests))
+			Expect(prober.results[val].latencies).To(HaveLen(prober.results[val].requests))
+		}
+		Expect(ExamplePlugin.prober).To(BeNil())
+	})
+	It("should count requests the router couldn't route as failed", func() {
+		ExamplePlugin.startProbing(client)
+		time.Sleep(20 * time.Millisecond)
+		setStatus(502)
+		time.Sleep(20 * time.Millisecond)
+		Expect(ExamplePlugin.stopProbing()).To(BeNumerically(">", 0))
+	})
+	It("should only fail the deployment when asked to", func() {
+		setStatus(503)
+		ExamplePlugin.startProbing(client)
+		time.Sleep(20 * time.Millisecond)
+		Expect(ExamplePlugin.finishProbing()).To(BeNil())
+		ExamplePlugin.probe_fail = true
+		ExamplePlugin.startProbing(client)
+		time.Sleep(20 * time.Millisecond)
+		err := ExamplePlugin.finishProbing()
+		Expect(err.Error()).To(HavePrefix("ERROR. "))
+		Expect(err.Error()).To(ContainSubstring(" requests to the production routes failed while they were switched\n"))
+	})
+	It("should stop probing when the deployment fails", func() {
+		failing := Step{"unmap", func(cliConnection plugin.CliConnection) error {
+			return errors.New("ERROR. unmap failed\n")
+		}}
+		ExamplePlugin.startProbing(client)
+		ExamplePlugin.runPipeline(connection, []Step{failing})
+		Expect(ExamplePlugin.prober).To(BeNil())
+	})
+})
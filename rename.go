@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//suffix of the new app while it runs next to the original one under --rename
+const green_suffix = "-green"
+
+//suffix of the old app once the new one has taken over its name
+const retired_suffix = "-retired-"
+
+func (c *SafeScaler) greenName(args []string) string {
+	if c.rename {
+		return args[1] + green_suffix
+	}
+	return args[2]
+}
+
+//gives the live app the original name. the old app is archived under a name with the deployment id or deleted
+func (c *SafeScaler) renameApps(cliConnection plugin.CliConnection) error {
+	if !c.rename {
+		return nil
+	}
+	name := c.blue.name
+	if c.delete_old {
+		if err := c.deleteApp(cliConnection, c.blue.name); err != nil {
+			return err
+		}
+	} else if err := c.renameApp(cliConnection, c.blue, name+retired_suffix+c.deployment); err != nil {
+		return err
+	}
+	if err := c.renameApp(cliConnection, c.green, name); err != nil {
+		return err
+	}
+	fmt.Println(name + " is now served by the new app")
+	return nil
+}
+
+func (c *SafeScaler) renameApp(cliConnection plugin.CliConnection, app *AppProp, name string) error {
+	if _, err := cliConnection.CliCommand("rename", app.name, name); err != nil {
+		return errors.New("ERROR. Could not rename " + app.name + " to " + name + "\n")
+	}
+	app.name = name
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry/cli/plugin/models"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("rename", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		ExamplePlugin = &SafeScaler{deployment: "20161018-120000-abc123"}
+	})
+	It("should only take a flag in place of the new app name with --rename", func() {
+		err := ExamplePlugin.getArgs([]string{"safe-scale", "shop", "--i", "2"})
+		Expect(err.Error()).To(Equal("ERROR. Insufficient arguments. Did not specify a name for new app\n"))
+	})
+	It("should parse the flags after the app name with --rename", func() {
+		err := ExamplePlugin.getArgs([]string{"safe-scale", "shop", "--rename", "--i", "2", "--delete-old"})
+		Expect(err).To(BeNil())
+		Expect(ExamplePlugin.rename).To(BeTrue())
+		Expect(ExamplePlugin.delete_old).To(BeTrue())
+		Expect(ExamplePlugin.inst).To(Equal("2"))
+	})
+	It("should name the new app after the original one", func() {
+		ExamplePlugin.rename = true
+		connection.GetAppReturns(plugin_models.GetAppModel{Name: "shop"}, nil)
+		err := ExamplePlugin.getApp(connection, []string{"safe-scale", "shop", "--rename"})
+		Expect(err).To(BeNil())
+		Expect(ExamplePlugin.green.name).To(Equal("shop-green"))
+	})
+	Describe("after power down", func() {
+		BeforeEach(func() {
+			ExamplePlugin.rename = true
+			ExamplePlugin.blue = &AppProp{name: "shop"}
+			ExamplePlugin.green = &AppProp{name: "shop-green"}
+			connection.CliCommandReturns([]string{"OK"}, nil)
+		})
+		It("should do nothing without --rename", func() {
+			ExamplePlugin.rename = false
+			err := ExamplePlugin.renameApps(connection)
+			Expect(err).To(BeNil())
+			Expect(connection.CliCommandCallCount()).To(Equal(0))
+		})
+		It("should archive the old app and give the new app its name", func() {
+			err := ExamplePlugin.renameApps(connection)
+			Expect(err).To(BeNil())
+			Expect(connection.CliCommandArgsForCall(0)).To(Equal([]string{"rename", "shop", "shop-retired-20161018-120000-abc123"}))
+			Expect(connection.CliCommandArgsForCall(1)).To(Equal([]string{"rename", "shop-green", "shop"}))
+			Expect(ExamplePlugin.green.name).To(Equal("shop"))
+			Expect(ExamplePlugin.blue.name).To(Equal("shop-retired-20161018-120000-abc123"))
+		})
+		It("should delete the old app with --delete-old", func() {
+			ExamplePlugin.delete_old = true
+			err := ExamplePlugin.renameApps(connection)
+			Expect(err).To(BeNil())
+			Expect(connection.CliCommandArgsForCall(0)).To(Equal([]string{"delete", "shop", "-f"}))
+			Expect(connection.CliCommandArgsForCall(1)).To(Equal([]string{"rename", "shop-green", "shop"}))
+		})
+		It("should fail if it can't rename an app", func() {
+			connection.CliCommandReturns(nil, errors.New("name taken"))
+			err := ExamplePlugin.renameApps(connection)
+			Expect(err.Error()).To(Equal("ERROR. Could not rename shop to shop-retired-20161018-120000-abc123\n"))
+		})
+	})
+})
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//retired versions of the app, newest first
+func (c *SafeScaler) retiredVersions(cliConnection plugin.CliConnection) []labelledResource {
+	selector := label_prefix + "role=" + role_retired + "," + label_prefix + "app=" + c.appName(cliConnection)
+	versions := c.labelled(cliConnection, "/v3/apps", selector)
+	sort.Sort(byDeployment(versions))
+	return versions
+}
+
+//deletes the retired versions beyond the --retain newest ones
+func (c *SafeScaler) pruneRetired(cliConnection plugin.CliConnection) error {
+	if c.retain < 0 {
+		return nil
+	}
+	for i, val := range c.retiredVersions(cliConnection) {
+		if i < c.retain {
+			continue
+		}
+		fmt.Println("Deleting retired version " + val.Name)
+		if err := c.deleteApp(cliConnection, val.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//starts the last retired version and moves the routes back to it with the same health check, mapping and draining
+//as a deployment. the live app becomes the old app and is retired
+func (c *SafeScaler) rollback(cliConnection plugin.CliConnection, args []string) error {
+	if len(args) == 1 {
+		return errors.New("ERROR. Insufficient arguments. Did not specify the app to roll back\n")
+	}
+	if err := c.parseFlags(args[2:]); err != nil {
+		return err
+	}
+	c.deployment = newDeploymentId()
+	client, err := c.newClient() //client for endpoint monitoring
+	if err != nil {
+		return err
+	}
+	if err := c.authorize(cliConnection, client); err != nil {
+		return err
+	}
+	c.client = client
+	get_app := Step{step_get_app, func(cliConnection plugin.CliConnection) error {
+		return c.getRetiredApp(cliConnection, args)
+	}}
+	start := Step{step_start, func(cliConnection plugin.CliConnection) error {
+		if err := c.startApp(cliConnection); err != nil {
+			return err
+		}
+		c.watchCrashes(cliConnection, c.green)
+		return nil
+	}}
+	err = c.runPipeline(cliConnection, append([]Step{get_app, start}, c.cutoverSteps()...))
+	//the live app is only stopped once the retired version took over
+	if err != nil && c.retired != nil && c.blue.alive {
+		return c.undoRollback(cliConnection, err)
+	}
+	return err
+}
+
+//the live app is the old app and the newest retired version the new app
+func (c *SafeScaler) getRetiredApp(cliConnection plugin.CliConnection, args []string) error {
+	if err := c.getApp(cliConnection, []string{args[0], args[1], ""}); err != nil {
+		return err
+	}
+	versions := c.retiredVersions(cliConnection)
+	if len(versions) == 0 {
+		return errors.New("ERROR. There is no retired version of " + c.blue.name + " to roll back to\n")
+	}
+	c.green = &AppProp{name: versions[0].Name, guid: versions[0].Guid, routes: []Route{}, alive: false}
+	c.retired = &versions[0].Metadata
+	//the live app holds the name of the app when it was deployed with --rename, so the rollback hands it on
+	c.rename = c.blue.name == c.appName(cliConnection)
+	fmt.Println("Rolling back " + c.blue.name + " to " + c.green.name)
+	return nil
+}
+
+//starts the retired version on a route of its own for the health test. it keeps the services it was bound to and
+//its retired labels until powerDown makes it live, so gc never takes it for an abandoned new app
+func (c *SafeScaler) startApp(cliConnection plugin.CliConnection) error {
+	if len(c.blue.routes) == 0 {
+		return errors.New("ERROR. Can't roll back because " + c.blue.name + " has no routes\n")
+	}
+	base, found := c.httpRoute()
+	if !found {
+		return errors.New("ERROR. Can't roll back because " + c.blue.name + " has no http routes\n")
+	}
+	if _, err := cliConnection.CliCommand("start", c.green.name); err != nil {
+		return errors.New("ERROR. Unable to start " + c.green.name + "\n")
+	}
+	c.green.alive = true
+	host, _, err := c.availableHost(cliConnection, c.green.name, base.domain)
+	if err != nil {
+		return err
+	}
+	if err = c.addMap(cliConnection, c.green, Route{host: host, domain: base.domain}); err != nil {
+		return err
+	}
+	c.labelApp(cliConnection, c.blue, role_blue)
+	c.labelRoute(cliConnection, c.green.routes[0], role_green)
+	return nil
+}
+
+//leaves the retired version the way the failed rollback found it. it is stopped and gets its labels back, which
+//aborting may have changed, so the next safe-scale-rollback finds it again
+func (c *SafeScaler) undoRollback(cliConnection plugin.CliConnection, cause error) error {
+	if c.green.alive {
+		if _, err := cliConnection.CliCommand("stop", c.green.name); err != nil {
+			return errors.New(cause.Error() + "ERROR. Unable to stop " + c.green.name + "\n")
+		}
+		c.green.alive = false
+	}
+	if err := c.setAppMetadata(cliConnection, c.green, *c.retired); err != nil {
+		fmt.Println("WARNING. Could not label " + c.green.name + " as " + role_retired + " again. " + err.Error())
+	}
+	c.labelApp(cliConnection, c.blue, role_live)
+	return cause
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin/models"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const retired_apps = `{"resources": [
+	{"guid": "v1-guid", "name": "shop-retired-20161001-120000-aaaaaa", "metadata": {"labels": {"safe-scale/deployment": "20161001-120000-aaaaaa"}}},
+	{"guid": "v3-guid", "name": "shop-retired-20161015-120000-cccccc", "metadata": {"labels": {"safe-scale/deployment": "20161015-120000-cccccc", "safe-scale/role": "retired"}}},
+	{"guid": "v2-guid", "name": "shop-retired-20161010-120000-bbbbbb", "metadata": {"labels": {"safe-scale/deployment": "20161010-120000-bbbbbb"}}}
+]}`
+
+var _ = Describe("rollback", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		retired       string
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		ExamplePlugin = &SafeScaler{}
+		retired = retired_apps
+		connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			if strings.HasPrefix(args[1], "/v3/apps?") && strings.Contains(args[1], "retired") {
+				return []string{retired}, nil
+			}
+			return []string{`{}`}, nil
+		}
+		connection.CliCommandReturns([]string{"OK"}, nil)
+	})
+	Describe("retaining versions", func() {
+		BeforeEach(func() {
+			ExamplePlugin.blue = &AppProp{name: "shop"}
+		})
+		It("should keep every version by default", func() {
+			ExamplePlugin.retain = -1
+			err := ExamplePlugin.pruneRetired(connection)
+			Expect(err).To(BeNil())
+			Expect(connection.CliCommandCallCount()).To(Equal(0))
+		})
+		It("should delete all but the newest versions", func() {
+			ExamplePlugin.retain = 1
+			err := ExamplePlugin.pruneRetired(connection)
+			Expect(err).To(BeNil())
+			Expect(connection.CliCommandCallCount()).To(Equal(2))
+			Expect(connection.CliCommandArgsForCall(0)).To(Equal([]string{"delete", "shop-retired-20161010-120000-bbbbbb", "-f"}))
+			Expect(connection.CliCommandArgsForCall(1)).To(Equal([]string{"delete", "shop-retired-20161001-120000-aaaaaa", "-f"}))
+		})
+		It("should only look at the versions of the same app", func() {
+			ExamplePlugin.retain = 0
+			ExamplePlugin.pruneRetired(connection)
+			Expect(connection.CliCommandWithoutTerminalOutputArgsForCall(0)[1]).To(ContainSubstring("safe-scale%2Fapp%3Dshop"))
+		})
+	})
+	Describe("rolling back", func() {
+		BeforeEach(func() {
+			domain_name := plugin_models.GetApp_DomainFields{Name: "cfapps.io"}
+			routes := []plugin_models.GetApp_RouteSummary{{Host: "shop", Domain: domain_name}}
+			connection.GetAppReturns(plugin_models.GetAppModel{Name: "shop", Guid: "live-guid", Routes: routes}, nil)
+		})
+		It("should fail without an app", func() {
+			err := ExamplePlugin.rollback(connection, []string{"safe-scale-rollback"})
+			Expect(err.Error()).To(Equal("ERROR. Insufficient arguments. Did not specify the app to roll back\n"))
+		})
+		It("should fail when there is no retired version", func() {
+			retired = `{"resources": []}`
+			err := ExamplePlugin.rollback(connection, []string{"safe-scale-rollback", "shop"})
+			Expect(err.Error()).To(Equal("ERROR. There is no retired version of shop to roll back to\n"))
+		})
+		It("should start the newest retired version and move the routes back to it", func() {
+			err := ExamplePlugin.rollback(connection, []string{"safe-scale-rollback", "shop"})
+			Expect(err).To(BeNil())
+			commands := cliCommands(connection)
+			Expect(commands[0]).To(Equal("start shop-retired-20161015-120000-cccccc"))
+			Expect(commands[1]).To(Equal("map-route shop-retired-20161015-120000-cccccc cfapps.io --hostname shop-retired-20161015-120000-cccccc"))
+			Expect(commands).To(ContainElement("map-route shop-retired-20161015-120000-cccccc cfapps.io --hostname shop"))
+			Expect(commands).To(ContainElement("unmap-route shop cfapps.io --hostname shop"))
+			Expect(commands).To(ContainElement("stop shop"))
+			//the live app held the app name so the restored version takes it over
+			Expect(commands[len(commands)-1]).To(Equal("rename shop-retired-20161015-120000-cccccc shop"))
+		})
+		It("should stop the retired version and keep it retired when the rollback fails", func() {
+			patches := []string{}
+			connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+				if strings.HasPrefix(args[1], "/v3/apps?") && strings.Contains(args[1], "retired") {
+					return []string{retired}, nil
+				}
+				if args[1] == "/v3/apps/v3-guid" && len(args) > 2 {
+					patches = append(patches, args[5])
+				}
+				return []string{`{}`}, nil
+			}
+			err := ExamplePlugin.rollback(connection, []string{"safe-scale-rollback", "shop", "--pre-hook", "health=exit 1"})
+			Expect(err.Error()).To(ContainSubstring("ERROR. The pre-hook of health failed"))
+			commands := cliCommands(connection)
+			Expect(commands[len(commands)-1]).To(Equal("stop shop-retired-20161015-120000-cccccc"))
+			Expect(commands).NotTo(ContainElement("stop shop"))
+			Expect(patches[len(patches)-1]).To(ContainSubstring(`"safe-scale/role":"retired"`))
+			Expect(patches[len(patches)-1]).To(ContainSubstring(`"safe-scale/deployment":"20161015-120000-cccccc"`))
+		})
+	})
+})
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//headers curl prints for a body it has already decoded
+var framing_headers = []string{"content-length:", "transfer-encoding:"}
+
+//runs cf with the input on stdin and returns what it wrote to stdout and stderr. cf ssh writes the remote session
+//to the terminal of the process, which the plugin rpc doesn't capture
+var run_cf = func(ctx context.Context, input []byte, args ...string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, "cf", args...)
+	command.Stdin = bytes.NewReader(input)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	err := command.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+//sends the requests to the app endpoints with curl in an instance of --probe-app through cf ssh, so routes that are
+//only reachable inside the cloud foundry network, like apps.internal, get the same checks. the request is handed to
+//curl as a config on stdin, so its headers and body never show up on a command line in the instance
+type sshTransport struct {
+	app             string
+	instance        int
+	insecure        bool
+	connect_timeout int
+	read_timeout    int
+}
+
+func (t *sshTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	config, err := t.config(request)
+	if err != nil {
+		return nil, err
+	}
+	stdout, stderr, err := run_cf(request.Context(), config, "ssh", t.app, "-i", strconv.Itoa(t.instance), "-c", "curl -sS -i --http1.1 -K -")
+	if err != nil {
+		return nil, errors.New("could not request " + request.URL.String() + " from instance #" + strconv.Itoa(t.instance) + " of " + t.app + ". " + strings.TrimSpace(err.Error()+" "+string(stderr)))
+	}
+	return parseCurl(stdout, request)
+}
+
+//curl config of the request
+func (t *sshTransport) config(request *http.Request) ([]byte, error) {
+	config := []string{"url = " + configQuote(request.URL.String()), "request = " + configQuote(request.Method)}
+	if t.insecure {
+		config = append(config, "insecure")
+	}
+	if t.connect_timeout > 0 {
+		config = append(config, "connect-timeout = "+strconv.Itoa(t.connect_timeout))
+	}
+	if t.connect_timeout > 0 && t.read_timeout > 0 {
+		config = append(config, "max-time = "+strconv.Itoa(t.connect_timeout+t.read_timeout))
+	}
+	for name, values := range request.Header {
+		for _, val := range values {
+			config = append(config, "header = "+configQuote(name+": "+val))
+		}
+	}
+	if request.Body != nil {
+		body, err := ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		//data-raw doesn't read a body starting with @ from a file
+		if len(body) > 0 {
+			config = append(config, "data-raw = "+configQuote(string(body)))
+		}
+	}
+	return []byte(strings.Join(config, "\n") + "\n"), nil
+}
+
+//response curl -i printed. interim 100 continue responses are skipped and the body is read to its end
+func parseCurl(output []byte, request *http.Request) (*http.Response, error) {
+	rest := output
+	for {
+		end := bytes.Index(rest, []byte("\r\n\r\n"))
+		if end < 0 {
+			return nil, errors.New("no response from " + request.URL.String())
+		}
+		headers := []string{}
+		for _, val := range strings.Split(string(rest[:end]), "\r\n") {
+			if !framingHeader(val) {
+				headers = append(headers, val)
+			}
+		}
+		body := rest[end+4:]
+		response, err := http.ReadResponse(bufio.NewReader(strings.NewReader(strings.Join(headers, "\r\n")+"\r\n\r\n"+string(body))), request)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode >= 200 {
+			return response, nil
+		}
+		rest = body
+	}
+}
+
+func framingHeader(line string) bool {
+	line = strings.ToLower(line)
+	for _, val := range framing_headers {
+		if strings.HasPrefix(line, val) {
+			return true
+		}
+	}
+	return false
+}
+
+//double quoted string of a curl config
+func configQuote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+type policyList struct {
+	Policies []struct {
+		Source struct {
+			Id string `json:"id"`
+		} `json:"source"`
+		Destination struct {
+			Id       string `json:"id"`
+			Protocol string `json:"protocol"`
+			Ports    struct {
+				Start int `json:"start"`
+				End   int `json:"end"`
+			} `json:"ports"`
+		} `json:"destination"`
+	} `json:"policies"`
+}
+
+type domainList struct {
+	Resources []struct {
+		Name     string `json:"name"`
+		Internal bool   `json:"internal"`
+	} `json:"resources"`
+}
+
+//lets --probe-app reach the apps of the deployment on --probe-port once they run. internal routes skip the router,
+//so the instance connects to the app containers, which takes a network policy. policies that were already there are
+//left out of c.allowed so revokeProbes only removes what this run added
+func (c *SafeScaler) allowProbes(cliConnection plugin.CliConnection) error {
+	if c.probe_app == "" {
+		return nil
+	}
+	if c.internal_domains == nil {
+		domains := domainList{}
+		if err := c.curl(cliConnection, &domains, "/v3/domains?per_page=5000"); err != nil {
+			return errors.New("ERROR. Could not list the domains to find the internal ones\n")
+		}
+		c.internal_domains = map[string]bool{}
+		for _, val := range domains.Resources {
+			c.internal_domains[val.Name] = val.Internal
+		}
+	}
+	for _, app := range []*AppProp{c.blue, c.green} {
+		if app == nil || !app.alive || app.reachable || app.name == c.probe_app {
+			continue
+		}
+		port := strconv.Itoa(c.probe_port)
+		exists, err := c.hasPolicy(cliConnection, app)
+		if err != nil {
+			return errors.New("ERROR. Could not list the network policies of " + c.probe_app + "\n")
+		}
+		if exists {
+			app.reachable = true
+			continue
+		}
+		fmt.Println("Allowing " + c.probe_app + " to reach " + app.name + " on port " + port)
+		if _, err := cliConnection.CliCommand("add-network-policy", c.probe_app, app.name, "--protocol", "tcp", "--port", port); err != nil {
+			return errors.New("ERROR. Could not allow " + c.probe_app + " to reach " + app.name + " on port " + port + "\n")
+		}
+		app.reachable = true
+		c.allowed = append(c.allowed, app)
+	}
+	return nil
+}
+
+//whether --probe-app can already reach the app on --probe-port
+func (c *SafeScaler) hasPolicy(cliConnection plugin.CliConnection, app *AppProp) (bool, error) {
+	probe, err := cliConnection.GetApp(c.probe_app)
+	if err != nil {
+		return false, err
+	}
+	guid, err := c.appGuid(cliConnection, app)
+	if err != nil {
+		return false, err
+	}
+	policies := policyList{}
+	if err := c.curl(cliConnection, &policies, "/networking/v1/external/policies?id="+probe.Guid); err != nil {
+		return false, err
+	}
+	for _, val := range policies.Policies {
+		to := val.Destination
+		if val.Source.Id == probe.Guid && to.Id == guid && to.Protocol == "tcp" && to.Ports.Start <= c.probe_port && c.probe_port <= to.Ports.End {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//removes the network policies this run added once the deployment is over. a policy that can't be removed is only
+//reported, the deployment already succeeded or failed on its own
+func (c *SafeScaler) revokeProbes(cliConnection plugin.CliConnection) {
+	port := strconv.Itoa(c.probe_port)
+	for _, app := range c.allowed {
+		fmt.Println("Removing the network policy from " + c.probe_app + " to " + app.name)
+		if _, err := cliConnection.CliCommand("remove-network-policy", c.probe_app, app.name, "--protocol", "tcp", "--port", port); err != nil {
+			fmt.Println("WARNING. Could not remove the network policy from " + c.probe_app + " to " + app.name + " on port " + port)
+		}
+	}
+	c.allowed = nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin"
+	"github.com/cloudfoundry/cli/plugin/models"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ssh", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		client        *http.Client
+		run           func(context.Context, []byte, ...string) ([]byte, []byte, error)
+		output        string
+		failure       error
+		commands      [][]string
+		inputs        []string
+		policies      string
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		policies = `{"policies": []}`
+		connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			if strings.HasPrefix(args[1], "/networking/v1/external/policies") {
+				return []string{policies}, nil
+			}
+			return []string{`{"resources": [{"name": "cfapps.io", "internal": false}, {"name": "apps.internal", "internal": true}]}`}, nil
+		}
+		connection.GetAppStub = func(name string) (plugin_models.GetAppModel, error) {
+			return plugin_models.GetAppModel{Name: name, Guid: name + "-guid"}, nil
+		}
+		output = "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 8\r\n\r\nall fine"
+		failure = nil
+		commands = [][]string{}
+		inputs = []string{}
+		run = run_cf
+		run_cf = func(ctx context.Context, input []byte, args ...string) ([]byte, []byte, error) {
+			commands = append(commands, args)
+			inputs = append(inputs, string(input))
+			if failure != nil {
+				return nil, []byte("Error opening SSH connection: ssh is disabled\n"), failure
+			}
+			return []byte(output), nil, nil
+		}
+		ExamplePlugin = &SafeScaler{
+			green:           &AppProp{name: "orders-v2", routes: []Route{{host: "orders-v2", domain: "apps.internal"}}, alive: true},
+			test:            "/health",
+			probe_app:       "orders-v1",
+			probe_instance:  1,
+			probe_port:      8080,
+			connect_timeout: 10,
+			read_timeout:    30,
+		}
+		client, _ = ExamplePlugin.newClient()
+	})
+	AfterEach(func() {
+		run_cf = run
+	})
+	It("should run the health test with curl in the probe app on the container port", func() {
+		Expect(ExamplePlugin.allowProbes(connection)).To(BeNil())
+		Expect(ExamplePlugin.healthTest(client)).To(BeTrue())
+		Expect(commands).To(Equal([][]string{{"ssh", "orders-v1", "-i", "1", "-c", "curl -sS -i --http1.1 -K -"}}))
+		Expect(inputs[0]).To(Equal("url = \"http://orders-v2.apps.internal:8080/health\"\nrequest = \"GET\"\nconnect-timeout = 10\nmax-time = 40\n"))
+	})
+	It("should hand the headers and body to curl on stdin", func() {
+		ExamplePlugin.skip_ssl_validation = true
+		client, _ = ExamplePlugin.newClient()
+		request, _ := http.NewRequest("POST", "https://orders.cfapps.io/cart", strings.NewReader("{\"note\": \"it's\"\n}"))
+		request.Header.Set("Authorization", "Bearer s3cret")
+		result, err := client.Do(request)
+		Expect(err).To(BeNil())
+		body, _ := ioutil.ReadAll(result.Body)
+		Expect(string(body)).To(Equal("all fine"))
+		Expect(result.Header.Get("Content-Type")).To(Equal("text/plain"))
+		Expect(strings.Join(commands[0], " ")).NotTo(ContainSubstring("s3cret"))
+		Expect(inputs[0]).To(ContainSubstring("insecure\n"))
+		Expect(inputs[0]).To(ContainSubstring(`header = "Authorization: Bearer s3cret"`))
+		Expect(inputs[0]).To(ContainSubstring(`data-raw = "{\"note\": \"it's\"\n}"`))
+	})
+	It("should read the status after interim responses and decoded bodies", func() {
+		output = "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3 pending"
+		result, err := client.Get("http://orders-v1.apps.internal:8080/transactions")
+		Expect(err).To(BeNil())
+		Expect(result.StatusCode).To(Equal(200))
+		body, _ := ioutil.ReadAll(result.Body)
+		Expect(string(body)).To(Equal("3 pending"))
+	})
+	It("should fail when the instance can't be reached", func() {
+		failure = errors.New("exit status 1")
+		_, err := client.Get("http://orders-v1.apps.internal:8080/transactions")
+		Expect(err.Error()).To(ContainSubstring("could not request http://orders-v1.apps.internal:8080/transactions from instance #1 of orders-v1. exit status 1 Error opening SSH connection: ssh is disabled"))
+		Expect(ExamplePlugin.healthTest(client)).To(BeFalse())
+	})
+	It("should allow the probe app to reach the apps once they run", func() {
+		ExamplePlugin.blue = &AppProp{name: "orders-v1", alive: true}
+		ExamplePlugin.green.alive = false
+		Expect(ExamplePlugin.allowProbes(connection)).To(BeNil())
+		Expect(connection.CliCommandCallCount()).To(Equal(0))
+		ExamplePlugin.green.alive = true
+		Expect(ExamplePlugin.allowProbes(connection)).To(BeNil())
+		Expect(ExamplePlugin.allowProbes(connection)).To(BeNil())
+		Expect(connection.CliCommandCallCount()).To(Equal(1))
+		Expect(connection.CliCommandArgsForCall(0)).To(Equal([]string{"add-network-policy", "orders-v1", "orders-v2", "--protocol", "tcp", "--port", "8080"}))
+		Expect(ExamplePlugin.url(Route{host: "orders", domain: "cfapps.io"}, "/health")).To(Equal("https://orders.cfapps.io/health"))
+	})
+	It("should remove the policies it added once the pipeline is over", func() {
+		err := ExamplePlugin.runPipeline(connection, []Step{{"push", func(cliConnection plugin.CliConnection) error {
+			return nil
+		}}})
+		Expect(err).To(BeNil())
+		Expect(cliCommands(connection)).To(Equal([]string{
+			"add-network-policy orders-v1 orders-v2 --protocol tcp --port 8080",
+			"remove-network-policy orders-v1 orders-v2 --protocol tcp --port 8080",
+		}))
+		Expect(ExamplePlugin.allowed).To(BeEmpty())
+	})
+	It("should keep the policies that were already there", func() {
+		policies = `{"policies": [{"source": {"id": "orders-v1-guid"}, "destination": {"id": "orders-v2-guid", "protocol": "tcp", "ports": {"start": 8000, "end": 9000}}}]}`
+		err := ExamplePlugin.runPipeline(connection, []Step{{"push", func(cliConnection plugin.CliConnection) error {
+			return nil
+		}}})
+		Expect(err).To(BeNil())
+		Expect(connection.CliCommandCallCount()).To(Equal(0))
+	})
+	It("should not take negative instances", func() {
+		err := ExamplePlugin.parseFlags([]string{"--probe-app", "orders-v1", "--probe-instance", "-1"})
+		Expect(err.Error()).To(Equal("ERROR. --probe-instance needs to be 0 or more\n"))
+	})
+})
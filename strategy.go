@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+const (
+	strategy_blue_green = "blue-green"
+	strategy_canary     = "canary"
+	strategy_rolling    = "rolling"
+	strategy_recreate   = "recreate"
+)
+
+//number of stages the canary strategy uses when neither --canary-steps nor --weights are given
+const default_canary_steps = 3
+
+//a way of replacing the running app with the new code. it is made of the steps that follow looking up the old app
+//and shares the health, drain and rollback building blocks of SafeScaler
+type Strategy interface {
+	Steps() []Step
+}
+
+func (c *SafeScaler) getStrategy() (Strategy, error) {
+	switch c.strategy {
+	case strategy_blue_green, "":
+		return &BlueGreen{c}, nil
+	case strategy_canary:
+		return &Canary{c}, nil
+	case strategy_rolling:
+		return &Rolling{c}, nil
+	case strategy_recreate:
+		return &Recreate{c}, nil
+	}
+	return nil, errors.New("ERROR. Unknown strategy " + c.strategy + ". Use blue-green, canary, rolling or recreate\n")
+}
+
+//strategies that replace the app under its own name instead of pushing a new app next to it
+func (c *SafeScaler) inPlace() bool {
+	return c.strategy == strategy_rolling || c.strategy == strategy_recreate
+}
+
+//pushes a new app next to the old one, moves the routes over once it is healthy and drains the old app
+type BlueGreen struct {
+	c *SafeScaler
+}
+
+func (s *BlueGreen) Steps() []Step {
+	return append([]Step{
+		{step_push, func(cliConnection plugin.CliConnection) error {
+			if err := s.c.pushNewApp(cliConnection); err != nil {
+				return err
+			}
+			s.c.watchCrashes(cliConnection, s.c.green)
+			return nil
+		}},
+		{step_bind, s.c.bindServices},
+		{step_version, s.c.checkVersion},
+		{step_task, s.c.preSwitchTask},
+	}, s.c.cutoverSteps()...)
+}
+
+//blue-green with traffic shifted to the new app in stages
+type Canary struct {
+	c *SafeScaler
+}
+
+func (s *Canary) Steps() []Step {
+	if s.c.canary_steps <= 0 && len(s.c.weights) == 0 {
+		s.c.canary_steps = default_canary_steps
+	}
+	return (&BlueGreen{s.c}).Steps()
+}
+
+//pushes the new code onto the app with cf's rolling deployment. cf picks when each old instance is replaced, so
+//there is nothing to hold for --trans and parseFlags rejects it
+type Rolling struct {
+	c *SafeScaler
+}
+
+func (s *Rolling) Steps() []Step {
+	return []Step{
+		{step_push, s.push},
+		{step_health, s.health},
+	}
+}
+
+func (s *Rolling) push(cliConnection plugin.CliConnection) error {
+	c := s.c
+	if len(c.blue.routes) == 0 {
+		return errors.New("ERROR. Can't do a rolling deployment because " + c.blue.name + " has no routes\n")
+	}
+	if _, err := cliConnection.CliCommand("push", c.blue.name, "-i", c.inst, "--strategy", strategy_rolling); err != nil {
+		return errors.New("ERROR. Unable to push " + c.blue.name + " with a rolling deployment\n")
+	}
+	//the app tests itself through its own routes
+	c.replaced = true
+	return nil
+}
+
+func (s *Rolling) health(cliConnection plugin.CliConnection) error {
+	c := s.c
+	if err := c.awaitInstances(cliConnection, c.blue); err != nil {
+		return err
+	}
+	if !c.healthTest(c.client) {
+		return errors.New("ERROR. " + c.blue.name + " is not healthy after the rolling deployment. Use cf rollback to go back to the previous revision\n")
+	}
+	c.labelApp(cliConnection, c.blue, role_live)
+	return nil
+}
+
+//takes the app off its production routes, optionally serving them from a maintenance app in the meantime, drains
+//it on temp routes and pushes the new code onto it before the routes come back
+type Recreate struct {
+	c *SafeScaler
+}
+
+func (s *Recreate) Steps() []Step {
+	return []Step{
+		{step_map, s.undoing(s.mapping)},
+		{step_unmap, s.undoing(s.unmapping)},
+		{step_drain, s.undoing(func(cliConnection plugin.CliConnection) error {
+			return s.c.monitorTransactions(s.c.client)
+		})},
+		{step_power_down, s.undoing(s.powerDown)},
+		{step_push, s.undoing(s.push)},
+		{step_health, s.health},
+		{step_remap, s.remap},
+	}
+}
+
+//until the new code runs the old app can still take the production routes back, so a failing step aborts
+func (s *Recreate) undoing(run func(plugin.CliConnection) error) func(plugin.CliConnection) error {
+	return func(cliConnection plugin.CliConnection) error {
+		if err := run(cliConnection); err != nil {
+			return s.c.abort(cliConnection, err.Error())
+		}
+		return nil
+	}
+}
+
+//temp routes for the app to drain on and the production routes for the maintenance app
+func (s *Recreate) mapping(cliConnection plugin.CliConnection) error {
+	c := s.c
+	if len(c.blue.routes) == 0 {
+		return errors.New("ERROR. Can't recreate " + c.blue.name + " because it has no routes\n")
+	}
+	if c.maintenance != "" {
+		c.standby = &AppProp{name: c.maintenance, routes: []Route{}, alive: true}
+	}
+	for _, base := range c.domainRoutes() {
+		temp_route, err := c.createRoute(cliConnection, base)
+		if err != nil {
+			return err
+		}
+		c.temp_routes = append(c.temp_routes, temp_route)
+		if err = c.addMap(cliConnection, c.blue, temp_route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Recreate) unmapping(cliConnection plugin.CliConnection) error {
+	c := s.c
+	for _, val := range c.blue_routes {
+		if c.standby != nil {
+			if err := c.addMap(cliConnection, c.standby, val); err != nil {
+				return err
+			}
+		}
+		if err := c.removeMap(cliConnection, c.blue, val, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Recreate) powerDown(cliConnection plugin.CliConnection) error {
+	if _, err := cliConnection.CliCommand("stop", s.c.blue.name); err != nil {
+		return errors.New("ERROR. Failed to stop " + s.c.blue.name + " from running\n")
+	}
+	s.c.blue.alive = false
+	return nil
+}
+
+func (s *Recreate) push(cliConnection plugin.CliConnection) error {
+	c := s.c
+	if _, err := cliConnection.CliCommand("push", c.blue.name, "-i", c.inst); err != nil {
+		return errors.New("ERROR. Unable to push " + c.blue.name + " to Cloud Foundry\n")
+	}
+	c.blue.alive = true
+	//the new code is tested through the temp routes before it gets the production routes back
+	c.replaced = true
+	return nil
+}
+
+func (s *Recreate) health(cliConnection plugin.CliConnection) error {
+	if err := s.c.awaitInstances(cliConnection, s.c.blue); err != nil {
+		return err
+	}
+	if !s.c.healthTest(s.c.client) {
+		return errors.New("ERROR. " + s.c.blue.name + " is not healthy. Production routes were not moved back to it\n")
+	}
+	return nil
+}
+
+func (s *Recreate) remap(cliConnection plugin.CliConnection) error {
+	c := s.c
+	for _, val := range c.blue_routes {
+		if err := c.addMap(cliConnection, c.blue, val); err != nil {
+			return err
+		}
+		if c.standby != nil {
+			if err := c.removeMap(cliConnection, c.standby, val, false); err != nil {
+				return err
+			}
+		}
+	}
+	for _, val := range c.temp_routes {
+		if err := c.removeMap(cliConnection, c.blue, val, true); err != nil {
+			return err
+		}
+	}
+	c.labelApp(cliConnection, c.blue, role_live)
+	fmt.Println(c.blue.name + " was recreated")
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	"github.com/nicholasf/fakepoint"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("strategy", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.CliCommandReturns([]string{"OK"}, nil)
+		ExamplePlugin = &SafeScaler{}
+	})
+	Describe("selecting", func() {
+		It("should default to blue-green", func() {
+			strategy, err := ExamplePlugin.getStrategy()
+			Expect(err).To(BeNil())
+			Expect(strategy).To(Equal(&BlueGreen{ExamplePlugin}))
+		})
+		It("should pick the strategy from the flag", func() {
+			err := ExamplePlugin.getArgs([]string{"safe-scale", "shop", "--strategy", "rolling"})
+			Expect(err).To(BeNil())
+			strategy, err := ExamplePlugin.getStrategy()
+			Expect(err).To(BeNil())
+			Expect(strategy).To(Equal(&Rolling{ExamplePlugin}))
+		})
+		It("should still need a new app name for blue-green", func() {
+			err := ExamplePlugin.getArgs([]string{"safe-scale", "shop", "--strategy", "canary"})
+			Expect(err.Error()).To(Equal("ERROR. Insufficient arguments. Did not specify a name for new app\n"))
+		})
+		It("should fail on an unknown strategy", func() {
+			ExamplePlugin.strategy = "big-bang"
+			_, err := ExamplePlugin.getStrategy()
+			Expect(err.Error()).To(Equal("ERROR. Unknown strategy big-bang. Use blue-green, canary, rolling or recreate\n"))
+		})
+		It("should give the canary strategy stages by default", func() {
+			ExamplePlugin.blue = &AppProp{name: "shop", routes: []Route{}}
+			(&Canary{ExamplePlugin}).Steps()
+			Expect(ExamplePlugin.canary_steps).To(Equal(default_canary_steps))
+		})
+	})
+	Describe("rolling", func() {
+		BeforeEach(func() {
+			ExamplePlugin.blue = &AppProp{name: "shop", routes: []Route{{host: "shop", domain: "cfapps.io"}}}
+			ExamplePlugin.green = ExamplePlugin.blue
+			ExamplePlugin.inst = "3"
+			ExamplePlugin.test = "/health"
+		})
+		It("should not take a transactions endpoint it can't wait for", func() {
+			err := ExamplePlugin.getArgs([]string{"safe-scale", "shop", "--strategy", "rolling", "--trans", "/trans"})
+			Expect(err.Error()).To(Equal("ERROR. --trans can't be used with --strategy rolling. cf replaces the instances without waiting for their transactions\n"))
+		})
+		It("should push with cf's rolling strategy", func() {
+			maker := fakepoint.NewFakepointMaker()
+			maker.NewGet("https://shop.cfapps.io/health", 200)
+			ExamplePlugin.client = maker.Client()
+			err := ExamplePlugin.runPipeline(connection, (&Rolling{ExamplePlugin}).Steps())
+			Expect(err).To(BeNil())
+			Expect(cliCommands(connection)).To(Equal([]string{"push shop -i 3 --strategy rolling"}))
+		})
+		It("should fail when the app is unhealthy after the push", func() {
+			maker := fakepoint.NewFakepointMaker()
+			maker.NewGet("https://shop.cfapps.io/health", 500)
+			ExamplePlugin.client = maker.Client()
+			err := ExamplePlugin.runPipeline(connection, (&Rolling{ExamplePlugin}).Steps())
+			Expect(err.Error()).To(Equal("ERROR. shop is not healthy after the rolling deployment. Use cf rollback to go back to the previous revision\n"))
+		})
+	})
+	Describe("recreate", func() {
+		BeforeEach(func() {
+			ExamplePlugin.blue = &AppProp{name: "shop", routes: []Route{{host: "shop", domain: "cfapps.io"}}, alive: true}
+			ExamplePlugin.green = ExamplePlugin.blue
+			ExamplePlugin.blue_routes = []Route{{host: "shop", domain: "cfapps.io"}}
+			ExamplePlugin.space = "sandbox"
+			ExamplePlugin.inst = "2"
+			ExamplePlugin.test = "/health"
+			ExamplePlugin.maintenance = "maintenance-page"
+		})
+		It("should serve the maintenance page while the app is replaced", func() {
+			maker := fakepoint.NewFakepointMaker()
+			maker.NewGet("https://temp-shop.cfapps.io/health", 200)
+			ExamplePlugin.client = maker.Client()
+			err := ExamplePlugin.runPipeline(connection, (&Recreate{ExamplePlugin}).Steps())
+			Expect(err).To(BeNil())
+			Expect(cliCommands(connection)).To(Equal([]string{
+				"create-route sandbox cfapps.io --hostname temp-shop",
+				"map-route shop cfapps.io --hostname temp-shop",
+				"map-route maintenance-page cfapps.io --hostname shop",
+				"unmap-route shop cfapps.io --hostname shop",
+				"stop shop",
+				"push shop -i 2",
+				"map-route shop cfapps.io --hostname shop",
+				"unmap-route maintenance-page cfapps.io --hostname shop",
+				"unmap-route shop cfapps.io --hostname temp-shop",
+				"delete-route cfapps.io --hostname temp-shop -f",
+			}))
+			Expect(ExamplePlugin.blue.routes).To(Equal([]Route{{host: "shop", domain: "cfapps.io"}}))
+		})
+		It("should leave the maintenance page up when the new code is unhealthy", func() {
+			maker := fakepoint.NewFakepointMaker()
+			maker.NewGet("https://temp-shop.cfapps.io/health", 500)
+			ExamplePlugin.client = maker.Client()
+			err := ExamplePlugin.runPipeline(connection, (&Recreate{ExamplePlugin}).Steps())
+			Expect(err.Error()).To(Equal("ERROR. shop is not healthy. Production routes were not moved back to it\n"))
+			Expect(cliCommands(connection)[len(cliCommands(connection))-1]).To(Equal("push shop -i 2"))
+		})
+		It("should keep the maintenance page up when a hook fails after the push", func() {
+			ExamplePlugin.post_hooks = Hooks{}
+			ExamplePlugin.post_hooks.Set("push=exit 1")
+			err := ExamplePlugin.runPipeline(connection, (&Recreate{ExamplePlugin}).Steps())
+			Expect(err.Error()).To(ContainSubstring("ERROR. Deployment was aborted. Production routes are served by maintenance-page\n"))
+			Expect(cliCommands(connection)).NotTo(ContainElement("map-route shop cfapps.io --hostname shop"))
+			Expect(cliCommands(connection)).NotTo(ContainElement("unmap-route maintenance-page cfapps.io --hostname shop"))
+			Expect(cliCommands(connection)).To(ContainElement("delete-route cfapps.io --hostname temp-shop -f"))
+		})
+		It("should give the old app its routes back when it doesn't drain in time", func() {
+			ExamplePlugin.trans = "/trans"
+			ExamplePlugin.timeout = 0
+			err := ExamplePlugin.runPipeline(connection, (&Recreate{ExamplePlugin}).Steps())
+			Expect(err.Error()).To(ContainSubstring("Can't safely shut down shop\n"))
+			Expect(err.Error()).To(ContainSubstring("ERROR. Deployment was aborted. Production routes are served by shop\n"))
+			Expect(cliCommands(connection)).NotTo(ContainElement("stop shop"))
+			Expect(cliCommands(connection)[4:]).To(Equal([]string{
+				"map-route shop cfapps.io --hostname shop",
+				"unmap-route maintenance-page cfapps.io --hostname shop",
+				"unmap-route shop cfapps.io --hostname temp-shop",
+				"delete-route cfapps.io --hostname temp-shop -f",
+			}))
+			Expect(ExamplePlugin.blue.hasRoute(Route{host: "shop", domain: "cfapps.io"})).To(BeTrue())
+		})
+		It("should bring the old code back when the push fails", func() {
+			connection.CliCommandStub = func(args ...string) ([]string, error) {
+				if args[0] == "push" {
+					return nil, errors.New("staging failed")
+				}
+				return []string{"OK"}, nil
+			}
+			err := ExamplePlugin.runPipeline(connection, (&Recreate{ExamplePlugin}).Steps())
+			Expect(err.Error()).To(ContainSubstring("ERROR. Unable to push shop to Cloud Foundry\nERROR. Deployment was aborted. Production routes are served by shop\n"))
+			Expect(cliCommands(connection)).To(ContainElement("start shop"))
+			Expect(cliCommands(connection)).To(ContainElement("map-route shop cfapps.io --hostname shop"))
+		})
+		It("should bring the old code back when a hook fails before the push", func() {
+			ExamplePlugin.post_hooks = Hooks{}
+			ExamplePlugin.post_hooks.Set("powerDown=exit 1")
+			err := ExamplePlugin.runPipeline(connection, (&Recreate{ExamplePlugin}).Steps())
+			Expect(err.Error()).To(ContainSubstring("ERROR. Deployment was aborted. Production routes are served by shop\n"))
+			Expect(cliCommands(connection)).To(ContainElement("start shop"))
+			Expect(cliCommands(connection)).To(ContainElement("unmap-route maintenance-page cfapps.io --hostname shop"))
+		})
+	})
+})
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//task states of the v3 api a task ends in
+const (
+	task_succeeded = "SUCCEEDED"
+	task_failed    = "FAILED"
+)
+
+type task struct {
+	Guid   string `json:"guid"`
+	Name   string `json:"name"`
+	State  string `json:"state"`
+	Result struct {
+		FailureReason string `json:"failure_reason"`
+	} `json:"result"`
+}
+
+type taskList struct {
+	Resources []task `json:"resources"`
+}
+
+//runs --pre-switch-task on the new app, e.g. a schema migration, and waits for it to finish. the routes are only
+//moved to the new app once the task succeeded
+func (c *SafeScaler) preSwitchTask(cliConnection plugin.CliConnection) error {
+	if c.pre_switch_task == "" {
+		return nil
+	}
+	name := "safe-scale-" + c.deployment
+	fmt.Println("Running task " + name + " on " + c.green.name + ": " + c.pre_switch_task)
+	if _, err := cliConnection.CliCommand("run-task", c.green.name, c.pre_switch_task, "--name", name); err != nil {
+		return errors.New("ERROR. Could not run the pre-switch task on " + c.green.name + "\n")
+	}
+	guid, err := c.appGuid(cliConnection, c.green)
+	if err != nil {
+		return errors.New("ERROR. Could not find " + c.green.name + " to follow task " + name + "\n")
+	}
+	path := "/v3/apps/" + guid + "/tasks?names=" + url.QueryEscape(name) + "&order_by=-created_at"
+	state := ""
+	base := time.Now()
+	for time.Since(base) < time.Duration(c.task_timeout)*time.Second {
+		tasks := taskList{}
+		if err := c.curl(cliConnection, &tasks, path); err != nil {
+			return errors.New("ERROR. Could not get the state of task " + name + ". " + err.Error() + "\n")
+		}
+		//the task shows up once cloud controller has scheduled it
+		if len(tasks.Resources) > 0 {
+			current := tasks.Resources[0]
+			if current.State != state {
+				state = current.State
+				fmt.Println("Task " + name + " is " + state)
+			}
+			switch state {
+			case task_succeeded:
+				return nil
+			case task_failed:
+				return errors.New("ERROR. Task " + name + " failed: " + current.Result.FailureReason + ". Routes were not moved to " + c.green.name + "\n")
+			}
+		}
+		time.Sleep(poll_interval)
+	}
+	return errors.New("ERROR. Task " + name + " did not finish within " + fmt.Sprint(c.task_timeout) + " seconds. Routes were not moved to " + c.green.name + "\n")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("pre-switch task", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		interval      time.Duration
+		states        []string
+		polls         int
+	)
+	BeforeEach(func() {
+		interval = poll_interval
+		poll_interval = 10 * time.Millisecond
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.CliCommandReturns([]string{"OK"}, nil)
+		states = []string{}
+		polls = 0
+		connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			if !strings.HasPrefix(args[1], "/v3/apps/green-guid/tasks?names=safe-scale-20261019-120000-abcdef") {
+				return nil, errors.New("unexpected curl")
+			}
+			polls++
+			if len(states) == 0 {
+				return []string{`{"resources": []}`}, nil
+			}
+			state := states[0]
+			if len(states) > 1 {
+				states = states[1:]
+			}
+			return []string{`{"resources": [{"guid": "task-guid", "state": "` + state + `", "result": {"failure_reason": "APP/TASK/migrate: Exited with status 1"}}]}`}, nil
+		}
+		ExamplePlugin = &SafeScaler{
+			green:           &AppProp{name: "shop-v2", guid: "green-guid", alive: true},
+			deployment:      "20261019-120000-abcdef",
+			pre_switch_task: "bin/rake db:migrate",
+			task_timeout:    5,
+		}
+	})
+	AfterEach(func() {
+		poll_interval = interval
+	})
+	It("should do nothing without a task", func() {
+		ExamplePlugin.pre_switch_task = ""
+		err := ExamplePlugin.preSwitchTask(connection)
+		Expect(err).To(BeNil())
+		Expect(connection.CliCommandCallCount()).To(Equal(0))
+	})
+	It("should run the task on the new app and wait for it to succeed", func() {
+		states = []string{"PENDING", "RUNNING", "RUNNING", "SUCCEEDED"}
+		err := ExamplePlugin.preSwitchTask(connection)
+		Expect(err).To(BeNil())
+		Expect(connection.CliCommandArgsForCall(0)).To(Equal([]string{"run-task", "shop-v2", "bin/rake db:migrate", "--name", "safe-scale-20261019-120000-abcdef"}))
+		Expect(polls).To(Equal(4))
+	})
+	It("should block the switch when the task fails", func() {
+		states = []string{"RUNNING", "FAILED"}
+		err := ExamplePlugin.preSwitchTask(connection)
+		Expect(err.Error()).To(Equal("ERROR. Task safe-scale-20261019-120000-abcdef failed: APP/TASK/migrate: Exited with status 1. Routes were not moved to shop-v2\n"))
+	})
+	It("should give up on a task that doesn't finish in time", func() {
+		ExamplePlugin.task_timeout = 0
+		err := ExamplePlugin.preSwitchTask(connection)
+		Expect(err.Error()).To(Equal("ERROR. Task safe-scale-20261019-120000-abcdef did not finish within 0 seconds. Routes were not moved to shop-v2\n"))
+	})
+	It("should fail when the task can't be started", func() {
+		connection.CliCommandReturns(nil, errors.New("no tasks"))
+		err := ExamplePlugin.preSwitchTask(connection)
+		Expect(err.Error()).To(Equal("ERROR. Could not run the pre-switch task on shop-v2\n"))
+	})
+	It("should run the task between pushing and testing the new app", func() {
+		names := []string{}
+		for _, step := range (&BlueGreen{ExamplePlugin}).Steps() {
+			names = append(names, step.name)
+		}
+		Expect(names[:5]).To(Equal([]string{"push", "bind", "version", "task", "health"}))
+	})
+})
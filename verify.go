@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//requests every http production route until the new app answers on it, so the old app is never unmapped from a
+//route the new app isn't reachable on. map-route can take a while to reach every router. without --verify-header
+//every instance of the new app has to answer
+func (c *SafeScaler) verifyRoutes(cliConnection plugin.CliConnection) error {
+	if !c.verify_routes {
+		return nil
+	}
+	model, err := cliConnection.GetApp(c.green.name)
+	if err != nil {
+		return errors.New("ERROR. Could not access " + c.green.name + " in Cloud Foundry\n")
+	}
+	instances := model.InstanceCount
+	if instances < 1 {
+		instances = 1
+	}
+	attempts := fmt.Sprint(c.verify_attempts)
+	for _, val := range c.blue_routes {
+		if val.port != 0 {
+			continue
+		}
+		if c.verify_header != "" && !c.servedBy(val, model.Guid, "") {
+			return c.abortTraffic(cliConnection, errors.New("ERROR. "+c.green.name+" did not answer on "+val.address()+" in "+attempts+" requests\n"))
+		}
+		for i := 0; i < instances && c.verify_header == ""; i++ {
+			if !c.servedBy(val, model.Guid, model.Guid+":"+strconv.Itoa(i)) {
+				return c.abortTraffic(cliConnection, errors.New("ERROR. Instance #"+strconv.Itoa(i)+" of "+c.green.name+" did not answer on "+val.address()+" in "+attempts+" requests\n"))
+			}
+		}
+		fmt.Println(val.address() + " is served by " + c.green.name)
+	}
+	return nil
+}
+
+//whether the app answered one of --verify-attempts requests to the route. without --verify-header the router is
+//asked for the instance with the X-Cf-App-Instance request header, and answers with a 404 while the route doesn't
+//reach it. with it the app has to name itself in that response header
+func (c *SafeScaler) servedBy(route Route, guid string, instance string) bool {
+	for i := 0; i < c.verify_attempts; i++ {
+		if i > 0 {
+			time.Sleep(poll_interval)
+		}
+		request, err := http.NewRequest("GET", c.url(route, c.verify_path), nil)
+		if err != nil {
+			return false
+		}
+		if instance != "" {
+			request.Header.Set(instance_header, instance)
+		}
+		result, err := c.client.Do(request)
+		if err != nil {
+			continue
+		}
+		result.Body.Close()
+		if c.verify_header != "" {
+			if strings.HasPrefix(result.Header.Get(c.verify_header), guid) {
+				return true
+			}
+			continue
+		}
+		//the router names its own errors, like an instance header of an app the route doesn't reach
+		if result.Header.Get("X-Cf-Routererror") == "" && result.StatusCode != 404 && result.StatusCode < 500 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin/models"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	"github.com/nicholasf/fakepoint"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("verify", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		maker         *fakepoint.FakepointMaker
+		interval      time.Duration
+		server        *httptest.Server
+		reaches       map[string]bool
+		requested     []string
+	)
+	BeforeEach(func() {
+		interval = poll_interval
+		poll_interval = time.Millisecond
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.CliCommandReturns([]string{"OK"}, nil)
+		connection.GetAppReturns(plugin_models.GetAppModel{Name: "shop-v2", Guid: "green-guid", InstanceCount: 2}, nil)
+		maker = fakepoint.NewFakepointMaker()
+		prod := []Route{{host: "shop", domain: "cfapps.io"}, {host: "shop", domain: "cfapps.io", path: "/api"}, {domain: "tcp.cfapps.io", port: 1024}}
+		temp := Route{host: "temp-shop", domain: "cfapps.io"}
+		ExamplePlugin = &SafeScaler{
+			blue:            &AppProp{name: "shop-v1", guid: "blue-guid", routes: append([]Route{temp}, prod...), alive: true},
+			green:           &AppProp{name: "shop-v2", guid: "green-guid", routes: append([]Route{}, prod...), alive: true},
+			blue_routes:     prod,
+			temp_routes:     []Route{temp},
+			verify_routes:   true,
+			verify_path:     "/",
+			verify_attempts: 3,
+		}
+		//routes, or route and instance pairs, the router reaches the new app on. it doesn't echo the instance header, like gorouter
+		reaches = map[string]bool{}
+		requested = []string{}
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			instance := r.Header.Get("X-Cf-App-Instance")
+			requested = append(requested, r.Host+r.URL.Path+" "+instance)
+			if !strings.HasPrefix(instance, "green-guid:") || !(reaches[r.Host+r.URL.Path] || reaches[r.Host+r.URL.Path+" "+instance]) {
+				w.Header().Set("X-Cf-Routererror", "unknown_route")
+				w.WriteHeader(404)
+			}
+		}))
+		ExamplePlugin.client = &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+				return net.Dial(network, server.Listener.Addr().String())
+			},
+		}}
+	})
+	AfterEach(func() {
+		poll_interval = interval
+		server.Close()
+	})
+	It("should do nothing unless asked to", func() {
+		ExamplePlugin.verify_routes = false
+		Expect(ExamplePlugin.verifyRoutes(connection)).To(BeNil())
+	})
+	It("should pass once the router reaches the new app on every http route", func() {
+		reaches["shop.cfapps.io/"] = true
+		reaches["shop.cfapps.io/api/"] = true
+		err := ExamplePlugin.verifyRoutes(connection)
+		Expect(err).To(BeNil())
+		Expect(connection.CliCommandCallCount()).To(Equal(0))
+		Expect(requested).To(Equal([]string{
+			"shop.cfapps.io/ green-guid:0",
+			"shop.cfapps.io/ green-guid:1",
+			"shop.cfapps.io/api/ green-guid:0",
+			"shop.cfapps.io/api/ green-guid:1",
+		}))
+	})
+	It("should hand the traffic back when an instance isn't reached", func() {
+		reaches["shop.cfapps.io/ green-guid:0"] = true
+		err := ExamplePlugin.verifyRoutes(connection)
+		Expect(err.Error()).To(Equal("ERROR. Instance #1 of shop-v2 did not answer on shop.cfapps.io in 3 requests\n" +
+			"ERROR. Deployment was aborted. Production routes are served by shop-v1\n"))
+	})
+	It("should hand the traffic back when the new app never answers on a route", func() {
+		reaches["shop.cfapps.io/"] = true
+		err := ExamplePlugin.verifyRoutes(connection)
+		Expect(err.Error()).To(Equal("ERROR. Instance #0 of shop-v2 did not answer on shop.cfapps.io/api in 3 requests\n" +
+			"ERROR. Deployment was aborted. Production routes are served by shop-v1\n"))
+		commands := cliCommands(connection)
+		Expect(commands).To(ContainElement("unmap-route shop-v2 cfapps.io --hostname shop --path /api"))
+		Expect(ExamplePlugin.blue.hasRoute(Route{host: "shop", domain: "cfapps.io", path: "/api"})).To(BeTrue())
+	})
+	It("should read the instance from the configured header", func() {
+		ExamplePlugin.client = maker.Client()
+		ExamplePlugin.verify_header = "X-App"
+		ExamplePlugin.verify_path = "/version"
+		maker.NewGet("https://shop.cfapps.io/version", 200).SetHeader("X-App", "blue-guid")
+		maker.NewGet("https://shop.cfapps.io/version", 200).SetHeader("X-App", "green-guid")
+		maker.NewGet("https://shop.cfapps.io/api/version", 200).SetHeader("X-App", "green-guid")
+		Expect(ExamplePlugin.verifyRoutes(connection)).To(BeNil())
+	})
+})
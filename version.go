@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//request header the router sends a request to a given instance of an app with, app_guid:index
+const instance_header = "X-Cf-App-Instance"
+
+//asks every instance of the new app for its version on --version-endpoint and stops the deployment before mapping
+//unless they all report --expect-version, so a push of the wrong directory never gets the routes
+func (c *SafeScaler) checkVersion(cliConnection plugin.CliConnection) error {
+	if c.expect_version == "" {
+		return nil
+	}
+	if err := c.awaitInstances(cliConnection, c.green); err != nil {
+		return err
+	}
+	model, err := cliConnection.GetApp(c.green.name)
+	if err != nil {
+		return errors.New("ERROR. Could not access " + c.green.name + " in Cloud Foundry\n")
+	}
+	instances := model.InstanceCount
+	if instances < 1 {
+		instances = 1
+	}
+	endpoint := c.url(c.probeRoute(c.green.routes), c.version_endpoint)
+	for i := 0; i < instances; i++ {
+		version, err := c.fetchVersion(endpoint, model.Guid+":"+strconv.Itoa(i))
+		if err != nil {
+			return errors.New("ERROR. Could not read the version of instance #" + strconv.Itoa(i) + " of " + c.green.name + ". " + err.Error() + "\n")
+		}
+		if !matchesVersion(version, c.expect_version) {
+			return errors.New("ERROR. Instance #" + strconv.Itoa(i) + " of " + c.green.name + " reports version " + version + " instead of " + c.expect_version + ". Routes were not moved to " + c.green.name + "\n")
+		}
+	}
+	fmt.Println("All " + strconv.Itoa(instances) + " instances of " + c.green.name + " report version " + c.expect_version)
+	return nil
+}
+
+//version an instance reports. the whole body unless --version-path picks a field out of a json body
+func (c *SafeScaler) fetchVersion(endpoint string, instance string) (string, error) {
+	request, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set(instance_header, instance)
+	result, err := c.client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer result.Body.Close()
+	if result.StatusCode != 200 {
+		return "", errors.New("status code " + strconv.Itoa(result.StatusCode))
+	}
+	body, err := ioutil.ReadAll(result.Body)
+	if err != nil {
+		return "", err
+	}
+	if c.version_path == "" {
+		return strings.TrimSpace(string(body)), nil
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(body)))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return "", errors.New("the body is not json")
+	}
+	value, err := jsonPath(document, c.version_path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(value), nil
+}
+
+//abbreviated git shas of 7 or more hex characters, and the full sha1 or sha-256 ones apps report
+var (
+	short_sha = regexp.MustCompile(`^[0-9a-fA-F]{7,}$`)
+	full_sha  = regexp.MustCompile(`^(?:[0-9a-fA-F]{40}|[0-9a-fA-F]{64})$`)
+)
+
+//a short git sha matches the full sha an app reports. anything else, like build numbers, has to be equal
+func matchesVersion(version string, expected string) bool {
+	if version == expected {
+		return true
+	}
+	return short_sha.MatchString(expected) && full_sha.MatchString(version) && strings.HasPrefix(strings.ToLower(version), strings.ToLower(expected))
+}
+
+var json_path_token = regexp.MustCompile(`^(?:\.([^.\[]+)|\[(\d+)\]|\['([^']*)'\]|\["([^"]*)"\])`)
+
+//field of the document at a json path like $.build.commit or $.builds[0]['git-sha']
+func jsonPath(document interface{}, path string) (interface{}, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	if !strings.HasPrefix(rest, ".") && !strings.HasPrefix(rest, "[") && rest != "" {
+		rest = "." + rest
+	}
+	value := document
+	for rest != "" {
+		match := json_path_token.FindStringSubmatch(rest)
+		if match == nil {
+			return nil, errors.New("invalid json path " + path)
+		}
+		rest = rest[len(match[0]):]
+		if match[2] != "" {
+			list, ok := value.([]interface{})
+			index, _ := strconv.Atoi(match[2])
+			if !ok || index >= len(list) {
+				return nil, errors.New(path + " is not in the body")
+			}
+			value = list[index]
+			continue
+		}
+		key := match[1] + match[3] + match[4]
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.New(path + " is not in the body")
+		}
+		if value, ok = object[key]; !ok {
+			return nil, errors.New(path + " is not in the body")
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin/models"
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("version", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		server        *httptest.Server
+		versions      map[string]string
+		requested     []string
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.GetAppReturns(plugin_models.GetAppModel{Name: "shop-v2", Guid: "green-guid", InstanceCount: 2, Instances: []plugin_models.GetApp_AppInstanceFields{
+			{State: "RUNNING"},
+			{State: "RUNNING"},
+		}}, nil)
+		versions = map[string]string{
+			"green-guid:0": `{"build": {"commit": "3f9c2a7d41e0b8c6a5f4e3d2c1b0a9f8e7d6c5b4", "number": 412}}`,
+			"green-guid:1": `{"build": {"commit": "3f9c2a7d41e0b8c6a5f4e3d2c1b0a9f8e7d6c5b4", "number": 412}}`,
+		}
+		requested = []string{}
+		//answers as the instance the router was asked for
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			instance := r.Header.Get("X-Cf-App-Instance")
+			requested = append(requested, r.Host+r.URL.Path+" "+instance)
+			body, found := versions[instance]
+			if !found {
+				w.WriteHeader(404)
+				return
+			}
+			w.Write([]byte(body))
+		}))
+		ExamplePlugin = &SafeScaler{
+			green:            &AppProp{name: "shop-v2", routes: []Route{{host: "shop-v2", domain: "cfapps.io"}}, alive: true},
+			expect_version:   "3f9c2a7",
+			version_endpoint: "/version",
+			version_path:     "$.build.commit",
+			client: &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+					return net.Dial(network, server.Listener.Addr().String())
+				},
+			}},
+		}
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+	It("should do nothing without an expected version", func() {
+		ExamplePlugin.expect_version = ""
+		Expect(ExamplePlugin.checkVersion(connection)).To(BeNil())
+		Expect(requested).To(BeEmpty())
+	})
+	It("should ask every instance for its version", func() {
+		err := ExamplePlugin.checkVersion(connection)
+		Expect(err).To(BeNil())
+		Expect(requested).To(Equal([]string{"shop-v2.cfapps.io/version green-guid:0", "shop-v2.cfapps.io/version green-guid:1"}))
+	})
+	It("should stop when an instance runs other code", func() {
+		versions["green-guid:1"] = `{"build": {"commit": "0000000d41e0b8c6a5f4e3d2c1b0a9f8e7d6c5b4", "number": 411}}`
+		err := ExamplePlugin.checkVersion(connection)
+		Expect(err.Error()).To(Equal("ERROR. Instance #1 of shop-v2 reports version 0000000d41e0b8c6a5f4e3d2c1b0a9f8e7d6c5b4 instead of 3f9c2a7. Routes were not moved to shop-v2\n"))
+	})
+	It("should read build numbers and plain bodies", func() {
+		ExamplePlugin.expect_version = "412"
+		ExamplePlugin.version_path = "build.number"
+		Expect(ExamplePlugin.checkVersion(connection)).To(BeNil())
+		versions["green-guid:0"] = "412\n"
+		versions["green-guid:1"] = "412\n"
+		ExamplePlugin.version_path = ""
+		Expect(ExamplePlugin.checkVersion(connection)).To(BeNil())
+	})
+	It("should only match the start of full git shas", func() {
+		Expect(matchesVersion("3f9c2a7d41e0b8c6a5f4e3d2c1b0a9f8e7d6c5b4", "3F9C2A7")).To(BeTrue())
+		Expect(matchesVersion("3f9c2a7d41e0b8c6a5f4e3d2c1b0a9f8e7d6c5b4", "3f9c2a")).To(BeFalse())
+		Expect(matchesVersion("12345678", "1234567")).To(BeFalse())
+		Expect(matchesVersion("1.2.30-rc1", "1.2.3")).To(BeFalse())
+		ExamplePlugin.expect_version = "1234567"
+		ExamplePlugin.version_path = "build.number"
+		versions["green-guid:0"] = `{"build": {"number": 12345678}}`
+		err := ExamplePlugin.checkVersion(connection)
+		Expect(err.Error()).To(Equal("ERROR. Instance #0 of shop-v2 reports version 12345678 instead of 1234567. Routes were not moved to shop-v2\n"))
+	})
+	It("should fail when an instance can't be asked", func() {
+		delete(versions, "green-guid:1")
+		err := ExamplePlugin.checkVersion(connection)
+		Expect(err.Error()).To(Equal("ERROR. Could not read the version of instance #1 of shop-v2. status code 404\n"))
+	})
+	It("should need an endpoint", func() {
+		err := ExamplePlugin.parseFlags([]string{"--expect-version", "3f9c2a7"})
+		Expect(err.Error()).To(Equal("ERROR. --expect-version needs a --version-endpoint to read the version from\n"))
+	})
+	Describe("json path", func() {
+		var document interface{}
+		BeforeEach(func() {
+			decoder := json.NewDecoder(strings.NewReader(`{"builds": [{"git-sha": "abc", "number": 7}], "app": {"version": "1.2.3"}}`))
+			decoder.UseNumber()
+			decoder.Decode(&document)
+		})
+		It("should follow fields, indexes and quoted keys", func() {
+			value, err := jsonPath(document, "$.app.version")
+			Expect(err).To(BeNil())
+			Expect(value).To(Equal("1.2.3"))
+			value, err = jsonPath(document, "$.builds[0]['git-sha']")
+			Expect(err).To(BeNil())
+			Expect(value).To(Equal("abc"))
+			value, err = jsonPath(document, `builds[0]["number"]`)
+			Expect(err).To(BeNil())
+			Expect(value).To(Equal(json.Number("7")))
+		})
+		It("should fail on paths that aren't in the document", func() {
+			_, err := jsonPath(document, "$.builds[1].number")
+			Expect(err.Error()).To(Equal("$.builds[1].number is not in the body"))
+			_, err = jsonPath(document, "$.app.version.major")
+			Expect(err).NotTo(BeNil())
+		})
+	})
+})
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//request of a --warmup-file request list
+type WarmupRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+//the parts of a recorded har file that are replayed
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method  string `json:"method"`
+				Url     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				PostData *struct {
+					Text string `json:"text"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+//headers of a recording that belong to the original connection rather than the request
+var skipped_headers = map[string]bool{"host": true, "content-length": true, "connection": true, "accept-encoding": true}
+
+//reads a json list of requests or a har file. requests of a har file are replayed against the path they were
+//recorded on
+func loadWarmup(path string) ([]WarmupRequest, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	requests := []WarmupRequest{}
+	if strings.HasPrefix(strings.TrimSpace(string(content)), "[") {
+		if err := json.Unmarshal(content, &requests); err != nil {
+			return nil, err
+		}
+	} else {
+		recording := harFile{}
+		if err := json.Unmarshal(content, &recording); err != nil {
+			return nil, err
+		}
+		for _, val := range recording.Log.Entries {
+			address, err := url.Parse(val.Request.Url)
+			if err != nil {
+				return nil, err
+			}
+			request := WarmupRequest{Method: val.Request.Method, Path: address.RequestURI(), Headers: map[string]string{}}
+			for _, header := range val.Request.Headers {
+				//http/2 recordings carry pseudo headers like :authority
+				if !strings.HasPrefix(header.Name, ":") && !skipped_headers[strings.ToLower(header.Name)] {
+					request.Headers[header.Name] = header.Value
+				}
+			}
+			if val.Request.PostData != nil {
+				request.Body = val.Request.PostData.Text
+			}
+			requests = append(requests, request)
+		}
+	}
+	if len(requests) == 0 {
+		return nil, errors.New("there are no requests in it")
+	}
+	return requests, nil
+}
+
+//replays the --warmup-file requests against the new app's own route before it gets the production routes, so
+//apps that are slow on their first requests are warm when the traffic arrives
+func (c *SafeScaler) warmUp(cliConnection plugin.CliConnection) error {
+	if c.warmup_file == "" {
+		return nil
+	}
+	requests, err := loadWarmup(c.warmup_file)
+	if err != nil {
+		return errors.New("ERROR. Could not read warm-up requests from " + c.warmup_file + ". " + err.Error() + "\n")
+	}
+	fmt.Printf("Warming up %s with %d requests for %d seconds\n", c.green.name, len(requests), c.warmup_duration)
+	stats := c.replay(c.client, c.probeRoute(c.green.routes), requests)
+	fmt.Printf("Warm-up of %s: %d errors, %s\n", c.green.name, stats.statuses["error"], stats.String())
+	return nil
+}
+
+//sends the requests in turn from --warmup-concurrency workers until --warmup-duration is up. every worker sends
+//at least one request
+func (c *SafeScaler) replay(client *http.Client, route Route, requests []WarmupRequest) *AccessStats {
+	stats := &AccessStats{statuses: map[string]int{}, latencies: []time.Duration{}}
+	var mutex sync.Mutex
+	var workers sync.WaitGroup
+	next := 0
+	deadline := time.Now().Add(time.Duration(c.warmup_duration) * time.Second)
+	workers.Add(c.warmup_concurrency)
+	for i := 0; i < c.warmup_concurrency; i++ {
+		go func() {
+			defer workers.Done()
+			for {
+				mutex.Lock()
+				request := requests[next%len(requests)]
+				next++
+				mutex.Unlock()
+				class, latency := send(client, c.url(route, request.Path), request)
+				mutex.Lock()
+				stats.requests++
+				stats.statuses[class]++
+				stats.latencies = append(stats.latencies, latency)
+				mutex.Unlock()
+				if time.Now().After(deadline) {
+					return
+				}
+			}
+		}()
+	}
+	workers.Wait()
+	sort.Slice(stats.latencies, func(i, j int) bool { return stats.latencies[i] < stats.latencies[j] })
+	return stats
+}
+
+//status class the request was answered with, or error, and how long it took
+func send(client *http.Client, endpoint string, request WarmupRequest) (string, time.Duration) {
+	method := request.Method
+	if method == "" {
+		method = "GET"
+	}
+	base := time.Now()
+	outgoing, err := http.NewRequest(method, endpoint, strings.NewReader(request.Body))
+	if err != nil {
+		return "error", time.Since(base)
+	}
+	for key, value := range request.Headers {
+		outgoing.Header.Set(key, value)
+	}
+	result, err := client.Do(outgoing)
+	if err != nil {
+		return "error", time.Since(base)
+	}
+	ioutil.ReadAll(result.Body)
+	result.Body.Close()
+	return fmt.Sprint(result.StatusCode/100) + "xx", time.Since(base)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("warmup", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		server        *httptest.Server
+		dir           string
+		mutex         sync.Mutex
+		requested     []string
+	)
+	BeforeEach(func() {
+		connection = &pluginfakes.FakeCliConnection{}
+		dir, _ = ioutil.TempDir("", "warmup")
+		requested = []string{}
+		server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			mutex.Lock()
+			requested = append(requested, r.Method+" "+r.Host+r.URL.RequestURI()+" "+r.Header.Get("Content-Type")+" "+string(body))
+			mutex.Unlock()
+			if r.URL.Path == "/broken" {
+				w.WriteHeader(500)
+			}
+		}))
+		ExamplePlugin = &SafeScaler{
+			green:              &AppProp{name: "shop-v2", routes: []Route{{host: "shop-v2", domain: "cfapps.io"}}, alive: true},
+			warmup_concurrency: 1,
+			client: &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				DialContext: func(ctx context.Context, network string, addr string) (net.Conn, error) {
+					return net.Dial(network, server.Listener.Addr().String())
+				},
+			}},
+		}
+	})
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+	It("should do nothing without requests", func() {
+		Expect(ExamplePlugin.warmUp(connection)).To(BeNil())
+		Expect(requested).To(BeEmpty())
+	})
+	It("should replay a request list against the new app", func() {
+		ExamplePlugin.warmup_file = filepath.Join(dir, "requests.json")
+		ioutil.WriteFile(ExamplePlugin.warmup_file, []byte(`[
+			{"path": "/products?page=2"},
+			{"method": "POST", "path": "/cart", "headers": {"Content-Type": "application/json"}, "body": "{\"sku\": 7}"}
+		]`), 0644)
+		ExamplePlugin.warmup_concurrency = 2
+		Expect(ExamplePlugin.warmUp(connection)).To(BeNil())
+		Expect(requested).To(ConsistOf("GET shop-v2.cfapps.io/products?page=2  ", `POST shop-v2.cfapps.io/cart application/json {"sku": 7}`))
+	})
+	It("should replay a har file on the recorded paths", func() {
+		ExamplePlugin.warmup_file = filepath.Join(dir, "shop.har")
+		ioutil.WriteFile(ExamplePlugin.warmup_file, []byte(`{"log": {"entries": [
+			{"request": {"method": "POST", "url": "https://shop.example.com/search?q=shoes", "headers": [
+				{"name": ":authority", "value": "shop.example.com"},
+				{"name": "Host", "value": "shop.example.com"},
+				{"name": "Content-Type", "value": "text/plain"}
+			], "postData": {"text": "shoes"}}}
+		]}}`), 0644)
+		Expect(ExamplePlugin.warmUp(connection)).To(BeNil())
+		Expect(requested).To(Equal([]string{"POST shop-v2.cfapps.io/search?q=shoes text/plain shoes"}))
+	})
+	It("should count errors and keep sending for the duration", func() {
+		stats := ExamplePlugin.replay(ExamplePlugin.client, ExamplePlugin.green.routes[0], []WarmupRequest{{Path: "/"}, {Path: "/broken"}})
+		Expect(stats.requests).To(Equal(1))
+		ExamplePlugin.warmup_concurrency = 3
+		stats = ExamplePlugin.replay(ExamplePlugin.client, ExamplePlugin.green.routes[0], []WarmupRequest{{Path: "/"}, {Path: "/broken"}})
+		Expect(stats.requests).To(Equal(3))
+		Expect(stats.statuses["5xx"] + stats.statuses["2xx"]).To(Equal(3))
+		Expect(stats.statuses["5xx"]).To(BeNumerically(">=", 1))
+		Expect(stats.latencies).To(HaveLen(3))
+	})
+	It("should fail on files it can't read", func() {
+		ExamplePlugin.warmup_file = filepath.Join(dir, "missing.json")
+		err := ExamplePlugin.warmUp(connection)
+		Expect(err.Error()).To(HavePrefix("ERROR. Could not read warm-up requests from " + ExamplePlugin.warmup_file))
+		ExamplePlugin.warmup_file = filepath.Join(dir, "empty.json")
+		ioutil.WriteFile(ExamplePlugin.warmup_file, []byte(`[]`), 0644)
+		err = ExamplePlugin.warmUp(connection)
+		Expect(err.Error()).To(Equal("ERROR. Could not read warm-up requests from " + ExamplePlugin.warmup_file + ". there are no requests in it\n"))
+	})
+})
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry/cli/plugin"
+)
+
+//error of cloud controllers that don't take weighted destinations
+const weights_unsupported = "weights are not supported"
+
+type destination struct {
+	App struct {
+		Guid    string `json:"guid"`
+		Process *struct {
+			Type string `json:"type"`
+		} `json:"process,omitempty"`
+	} `json:"app"`
+	Weight   *int   `json:"weight,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+type destinationList struct {
+	Destinations []destination `json:"destinations"`
+}
+
+//percentages of traffic for the new app. they have to increase and lie between 1 and 100. the last step always
+//shifts all traffic, so 100 is added when it isn't given
+func parseWeights(value string) ([]int, error) {
+	weights := []int{}
+	if value == "" {
+		return weights, nil
+	}
+	for _, val := range strings.Split(value, ",") {
+		weight, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil || weight < 1 || weight > 100 || (len(weights) > 0 && weight <= weights[len(weights)-1]) {
+			return nil, errors.New("ERROR. --weights must be increasing percentages between 1 and 100\n")
+		}
+		weights = append(weights, weight)
+	}
+	if weights[len(weights)-1] != 100 {
+		weights = append(weights, 100)
+	}
+	return weights, nil
+}
+
+//destination of the app on a route. a weight of 0 leaves the destination unweighted
+func newDestination(guid string, weight int) destination {
+	dest := destination{}
+	dest.App.Guid = guid
+	if weight > 0 {
+		dest.Weight = &weight
+	}
+	return dest
+}
+
+//guid of the route and the destinations on it that belong to other apps
+func (c *SafeScaler) otherDestinations(cliConnection plugin.CliConnection, route Route, apps []string) (string, []destination, error) {
+	guid, err := c.routeGuid(cliConnection, route)
+	if err != nil {
+		return "", nil, err
+	}
+	current := destinationList{}
+	if err := c.curl(cliConnection, &current, "/v3/routes/"+guid+"/destinations"); err != nil {
+		return "", nil, err
+	}
+	others := []destination{}
+	for _, val := range current.Destinations {
+		if !contains(apps, val.App.Guid) {
+			others = append(others, val)
+		}
+	}
+	return guid, others, nil
+}
+
+//replaces the destinations of the apps on the route with the v3 routes api. the api replaces every destination of
+//the route, so the ones of other apps are sent along as they are. cloud controller takes either all destinations
+//weighted or none, so weights are never sent next to other apps
+func (c *SafeScaler) setDestinations(cliConnection plugin.CliConnection, route Route, apps []string, destinations ...destination) error {
+	guid, kept, err := c.otherDestinations(cliConnection, route, apps)
+	if err != nil {
+		return err
+	}
+	for _, val := range destinations {
+		if val.Weight != nil && len(kept) > 0 {
+			return errors.New(route.name() + " is shared with other apps")
+		}
+	}
+	body, err := json.Marshal(map[string][]destination{"destinations": append(kept, destinations...)})
+	if err != nil {
+		return err
+	}
+	return c.curl(cliConnection, nil, "/v3/routes/"+guid+"/destinations", "-X", "PATCH", "-d", string(body))
+}
+
+//splits the traffic on a route between the apps. at 100 percent the old app is taken off the route
+func (c *SafeScaler) setWeight(cliConnection plugin.CliConnection, route Route, blue_guid string, green_guid string, weight int) error {
+	apps := []string{blue_guid, green_guid}
+	if weight == 100 {
+		return c.setDestinations(cliConnection, route, apps, newDestination(green_guid, 0))
+	}
+	return c.setDestinations(cliConnection, route, apps, newDestination(blue_guid, 100-weight), newDestination(green_guid, weight))
+}
+
+//shifts the traffic on the production http routes to the new app by the --weights percentages, holding every step
+//while the checks run. foundations without weighted destinations, and routes other apps are mapped to, fall back to
+//shifting instances
+func (c *SafeScaler) weightedCanary(cliConnection plugin.CliConnection, client *http.Client) error {
+	http_routes := []Route{}
+	for _, val := range c.blue_routes {
+		if val.port == 0 {
+			http_routes = append(http_routes, val)
+		}
+	}
+	blue_guid, err := c.appGuid(cliConnection, c.blue)
+	if err != nil {
+		return errors.New("ERROR. Could not find the guid of " + c.blue.name + "\n")
+	}
+	green_guid, err := c.appGuid(cliConnection, c.green)
+	if err != nil {
+		return errors.New("ERROR. Could not find the guid of " + c.green.name + "\n")
+	}
+	for _, val := range http_routes {
+		_, others, err := c.otherDestinations(cliConnection, val, []string{blue_guid, green_guid})
+		if err != nil {
+			return errors.New("ERROR. Could not read the destinations of " + val.name() + "\n")
+		}
+		if len(others) > 0 {
+			fmt.Println("WARNING. " + val.name() + " is shared with other apps, which can't be weighted against. Shifting instances instead")
+			return c.instanceCanary(cliConnection, client)
+		}
+	}
+	for step, weight := range c.weights {
+		for i, val := range http_routes {
+			if err := c.setWeight(cliConnection, val, blue_guid, green_guid, weight); err != nil {
+				if step == 0 && i == 0 && strings.Contains(strings.ToLower(err.Error()), weights_unsupported) {
+					fmt.Println("WARNING. Route weights are not supported. " + err.Error())
+					return c.instanceCanary(cliConnection, client)
+				}
+				return c.abortWeights(cliConnection, http_routes, blue_guid, errors.New("ERROR. Could not shift "+strconv.Itoa(weight)+"% of "+val.name()+" to "+c.green.name+"\n"))
+			}
+			if step == 0 {
+				c.green.routes = append(c.green.routes, val)
+			}
+			if weight == 100 {
+				c.blue.dropRoute(val)
+			}
+		}
+		if step == 0 {
+			//tcp routes can't be weighted so the new app joins them once it takes traffic
+			for _, val := range c.blue_routes {
+				if val.port == 0 {
+					continue
+				}
+				if err := c.addMap(cliConnection, c.green, val); err != nil {
+					return c.abortWeights(cliConnection, http_routes, blue_guid, err)
+				}
+			}
+		}
+		fmt.Printf("Shifted %d%% of traffic to %s\n", weight, c.green.name)
+		if err := c.holdCanary(client); err != nil {
+			return c.abortWeights(cliConnection, http_routes, blue_guid, err)
+		}
+	}
+	return nil
+}
+
+//maps the new app to the production routes next to the old app and shifts instances instead of weights
+func (c *SafeScaler) instanceCanary(cliConnection plugin.CliConnection, client *http.Client) error {
+	for _, val := range c.blue_routes {
+		if err := c.addMap(cliConnection, c.green, val); err != nil {
+			return err
+		}
+	}
+	if err := c.scaleApp(cliConnection, c.green, 1); err != nil {
+		return err
+	}
+	if c.canary_steps <= 0 {
+		c.canary_steps = len(c.weights)
+	}
+	c.weights = []int{}
+	return c.canary(cliConnection, client)
+}
+
+//hands all traffic back to the old app. the new app is taken off the production routes and left running
+func (c *SafeScaler) abortWeights(cliConnection plugin.CliConnection, http_routes []Route, blue_guid string, cause error) error {
+	fmt.Println("Rolling back the weighted canary")
+	for _, val := range http_routes {
+		if err := c.setDestinations(cliConnection, val, []string{blue_guid, c.green.guid}, newDestination(blue_guid, 0)); err != nil {
+			return errors.New(cause.Error() + "ERROR. Could not move " + val.name() + " back to " + c.blue.name + "\n")
+		}
+		c.green.dropRoute(val)
+		if !c.blue.hasRoute(val) {
+			c.blue.routes = append(c.blue.routes, val)
+		}
+	}
+	for _, val := range c.blue_routes {
+		if val.port != 0 && c.green.hasRoute(val) {
+			if err := c.removeMap(cliConnection, c.green, val, false); err != nil {
+				return err
+			}
+		}
+	}
+	for _, val := range c.temp_routes {
+		if err := c.removeMap(cliConnection, c.blue, val, true); err != nil {
+			return err
+		}
+	}
+	c.labelApp(cliConnection, c.blue, role_live)
+	return errors.New(cause.Error() + "ERROR. Canary was rolled back. Production routes are served by " + c.blue.name + " only\n")
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/cli/plugin/pluginfakes"
+	"github.com/nicholasf/fakepoint"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("weights", func() {
+	var (
+		connection    *pluginfakes.FakeCliConnection
+		ExamplePlugin *SafeScaler
+		maker         *fakepoint.FakepointMaker
+		interval      time.Duration
+		patches       []string
+		supported     bool
+		current       string
+		failure       string
+	)
+	BeforeEach(func() {
+		interval = poll_interval
+		poll_interval = 10 * time.Millisecond
+		connection = &pluginfakes.FakeCliConnection{}
+		connection.CliCommandReturns([]string{"OK"}, nil)
+		patches = []string{}
+		supported = true
+		current = `{"destinations": [{"guid": "destination-guid", "app": {"guid": "blue-guid"}}]}`
+		failure = ""
+		connection.CliCommandWithoutTerminalOutputStub = func(args ...string) ([]string, error) {
+			switch {
+			case strings.HasPrefix(args[1], "/v3/domains?"):
+				return []string{`{"resources": [{"guid": "domain-guid"}]}`}, nil
+			case strings.HasPrefix(args[1], "/v3/routes?"):
+				return []string{`{"resources": [{"guid": "route-guid", "host": "shop"}]}`}, nil
+			case args[1] == "/v3/routes/route-guid/destinations" && len(args) == 2:
+				return []string{current}, nil
+			case args[1] == "/v3/routes/route-guid/destinations":
+				if failure != "" {
+					return []string{`{"errors": [{"detail": "` + failure + `"}]}`}, nil
+				}
+				if !supported {
+					return []string{`{"errors": [{"detail": "Destinations with weights are not supported"}]}`}, nil
+				}
+				patches = append(patches, args[5])
+				return []string{`{}`}, nil
+			}
+			return nil, errors.New("unexpected curl")
+		}
+		maker = fakepoint.NewFakepointMaker()
+		prod := []Route{{host: "shop", domain: "cfapps.io"}}
+		temp := []Route{{host: "temp-shop", domain: "cfapps.io"}}
+		ExamplePlugin = &SafeScaler{
+			blue:        &AppProp{name: "shop-v1", guid: "blue-guid", routes: append(append([]Route{}, prod...), temp...), instances: 4},
+			green:       &AppProp{name: "shop-v2", guid: "green-guid", routes: []Route{{host: "shop-v2", domain: "cfapps.io"}}},
+			blue_routes: prod,
+			temp_routes: temp,
+			test:        "/health",
+			inst:        "4",
+			weights:     []int{10, 50, 100},
+		}
+	})
+	AfterEach(func() {
+		poll_interval = interval
+	})
+	It("should parse increasing percentages", func() {
+		weights, err := parseWeights("5, 25,50,100")
+		Expect(err).To(BeNil())
+		Expect(weights).To(Equal([]int{5, 25, 50, 100}))
+		weights, err = parseWeights("10,50")
+		Expect(err).To(BeNil())
+		Expect(weights).To(Equal([]int{10, 50, 100}))
+		weights, err = parseWeights("")
+		Expect(err).To(BeNil())
+		Expect(weights).To(Equal([]int{}))
+	})
+	It("should reject weights that aren't increasing percentages", func() {
+		for _, val := range []string{"50,25", "0,100", "5,150", "five"} {
+			_, err := parseWeights(val)
+			Expect(err.Error()).To(Equal("ERROR. --weights must be increasing percentages between 1 and 100\n"))
+		}
+	})
+	It("should not map the production routes to the new app up front", func() {
+		ExamplePlugin.blue.routes = []Route{{host: "shop", domain: "cfapps.io"}}
+		ExamplePlugin.temp_routes = []Route{}
+		connection.CliCommandWithoutTerminalOutputStub = nil
+		err := ExamplePlugin.mapping(connection)
+		Expect(err).To(BeNil())
+		for i := 0; i < connection.CliCommandCallCount(); i++ {
+			Expect(connection.CliCommandArgsForCall(i)[1]).NotTo(Equal("shop-v2"))
+		}
+	})
+	It("should shift the traffic by weight", func() {
+		maker.NewGet("https://shop-v2.cfapps.io/health", 200).Duplicate(10)
+		err := ExamplePlugin.canary(connection, maker.Client())
+		Expect(err).To(BeNil())
+		Expect(patches).To(Equal([]string{
+			`{"destinations":[{"app":{"guid":"blue-guid"},"weight":90},{"app":{"guid":"green-guid"},"weight":10}]}`,
+			`{"destinations":[{"app":{"guid":"blue-guid"},"weight":50},{"app":{"guid":"green-guid"},"weight":50}]}`,
+			`{"destinations":[{"app":{"guid":"green-guid"}}]}`,
+		}))
+		Expect(ExamplePlugin.green.routes).To(Equal([]Route{{host: "shop-v2", domain: "cfapps.io"}, {host: "shop", domain: "cfapps.io"}}))
+		Expect(ExamplePlugin.blue.routes).To(Equal([]Route{{host: "temp-shop", domain: "cfapps.io"}}))
+		Expect(connection.CliCommandCallCount()).To(Equal(0))
+	})
+	It("should shift instances when other apps share the route", func() {
+		current = `{"destinations": [{"guid": "destination-guid", "app": {"guid": "blue-guid"}}, ` +
+			`{"guid": "other-destination-guid", "app": {"guid": "admin-guid", "process": {"type": "web"}}, "port": 9090, "protocol": "http1"}]}`
+		maker.NewGet("https://shop-v2.cfapps.io/health", 200).Duplicate(10)
+		err := ExamplePlugin.canary(connection, maker.Client())
+		Expect(err).To(BeNil())
+		Expect(patches).To(BeEmpty())
+		Expect(cliCommands(connection)[:2]).To(Equal([]string{"map-route shop-v2 cfapps.io --hostname shop", "scale shop-v2 -i 1"}))
+	})
+	It("should keep the destinations of other apps when it moves the traffic back", func() {
+		current = `{"destinations": [{"guid": "other-destination-guid", "app": {"guid": "admin-guid", "process": {"type": "web"}}, "port": 9090, "protocol": "http1"}]}`
+		err := ExamplePlugin.abortWeights(connection, ExamplePlugin.blue_routes, "blue-guid", errors.New("ERROR. shop-v2 is not healthy\n"))
+		Expect(err.Error()).To(ContainSubstring("ERROR. Canary was rolled back"))
+		Expect(patches).To(Equal([]string{`{"destinations":[{"app":{"guid":"admin-guid","process":{"type":"web"}},"port":9090,"protocol":"http1"},{"app":{"guid":"blue-guid"}}]}`}))
+	})
+	It("should never weigh against other apps", func() {
+		current = `{"destinations": [{"guid": "other-destination-guid", "app": {"guid": "admin-guid"}}]}`
+		err := ExamplePlugin.setWeight(connection, Route{host: "shop", domain: "cfapps.io"}, "blue-guid", "green-guid", 50)
+		Expect(err.Error()).To(Equal("cfapps.io.shop is shared with other apps"))
+		Expect(patches).To(BeEmpty())
+	})
+	It("should roll back instead of shifting instances when the route can't be updated", func() {
+		failure = "You are not authorized to perform the requested action"
+		maker.NewGet("https://shop-v2.cfapps.io/health", 200).Duplicate(10)
+		err := ExamplePlugin.canary(connection, maker.Client())
+		Expect(err.Error()).To(ContainSubstring("ERROR. Could not shift 10% of cfapps.io.shop to shop-v2\n"))
+		Expect(connection.CliCommandCallCount()).To(Equal(0))
+	})
+	It("should skip routes the old app was taken off when unmapping", func() {
+		ExamplePlugin.blue.routes = []Route{{host: "temp-shop", domain: "cfapps.io"}}
+		ExamplePlugin.green.routes = []Route{{host: "shop-v2", domain: "cfapps.io"}, {host: "shop", domain: "cfapps.io"}}
+		err := ExamplePlugin.unmapping(connection)
+		Expect(err).To(BeNil())
+		Expect(connection.CliCommandArgsForCall(0)).To(Equal([]string{"unmap-route", "shop-v2", "cfapps.io", "--hostname", "shop-v2"}))
+	})
+	It("should move the traffic back to the old app when a step fails", func() {
+		maker.NewGet("https://shop-v2.cfapps.io/health", 200)
+		maker.NewGet("https://shop-v2.cfapps.io/health", 500)
+		err := ExamplePlugin.canary(connection, maker.Client())
+		Expect(err.Error()).To(Equal("ERROR. shop-v2 is not healthy\nERROR. Canary was rolled back. Production routes are served by shop-v1 only\n"))
+		Expect(patches[len(patches)-1]).To(Equal(`{"destinations":[{"app":{"guid":"blue-guid"}}]}`))
+		Expect(ExamplePlugin.green.routes).To(Equal([]Route{{host: "shop-v2", domain: "cfapps.io"}}))
+		Expect(ExamplePlugin.blue.routes).To(Equal([]Route{{host: "shop", domain: "cfapps.io"}}))
+	})
+	It("should fall back to shifting instances when weights are unsupported", func() {
+		supported = false
+		maker.NewGet("https://shop-v2.cfapps.io/health", 200).Duplicate(10)
+		err := ExamplePlugin.canary(connection, maker.Client())
+		Expect(err).To(BeNil())
+		commands := cliCommands(connection)
+		Expect(commands).To(Equal([]string{
+			"map-route shop-v2 cfapps.io --hostname shop",
+			"scale shop-v2 -i 1",
+			"scale shop-v2 -i 2",
+			"scale shop-v1 -i 3",
+			"scale shop-v2 -i 3",
+			"scale shop-v1 -i 2",
+			"scale shop-v2 -i 4",
+			"scale shop-v1 -i 1",
+		}))
+	})
+})